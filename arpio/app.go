@@ -0,0 +1,69 @@
+package arpio
+
+import (
+	"fmt"
+	ac "github.com/arpio/arpio-client-go"
+	"sort"
+	"strings"
+)
+
+// describeAppChanges describes the changes to the Terraform-managed fields of
+// an app that updating it from one version to another would make, one line
+// per change.  The lines name the attributes of the arpio_app resource.
+func describeAppChanges(from, to ac.App) []string {
+	var changes []string
+
+	describe := func(attr, from, to string) {
+		if from != to {
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", attr, from, to))
+		}
+	}
+	describe("rpo", FormatRPO(from.RPO), FormatRPO(to.RPO))
+	describe("primary_account_id", from.SourceAwsAccountID, to.SourceAwsAccountID)
+	describe("primary_region", from.SourceRegion, to.SourceRegion)
+	describe("recovery_account_id", from.TargetAwsAccountID, to.TargetAwsAccountID)
+	describe("recovery_region", from.TargetRegion, to.TargetRegion)
+	describe("notification_emails", formatStringList(from.NotificationEmails), formatStringList(to.NotificationEmails))
+
+	// Selection rules are unordered, so compare them as multisets
+	counts := map[string]int{}
+	for _, rule := range from.SelectionRules {
+		counts[describeSelectionRule(rule)]++
+	}
+	for _, rule := range to.SelectionRules {
+		counts[describeSelectionRule(rule)]--
+	}
+	for _, rule := range SortedIntMapKeys(counts) {
+		switch {
+		case counts[rule] > 0:
+			changes = append(changes, fmt.Sprintf("resources: removes %s", rule))
+		case counts[rule] < 0:
+			changes = append(changes, fmt.Sprintf("resources: adds %s", rule))
+		}
+	}
+
+	return changes
+}
+
+func describeSelectionRule(rule ac.SelectionRule) string {
+	switch rule.GetRuleType() {
+	case ac.ArnRuleType:
+		return fmt.Sprintf("ARNs %s", formatStringList(rule.(ac.ArnRule).Arns))
+	case ac.TagRuleType:
+		tagRule := rule.(ac.TagRule)
+		if tagRule.Value == "" {
+			return fmt.Sprintf("tag %s with any value", tagRule.Name)
+		}
+		return fmt.Sprintf("tag %s=%q", tagRule.Name, tagRule.Value)
+	default:
+		return fmt.Sprintf("%s rule", rule.GetRuleType())
+	}
+}
+
+// formatStringList formats a list of strings in sorted order, so lists with
+// the same elements are formatted the same way.
+func formatStringList(values []string) string {
+	sorted := append([]string{}, values...)
+	sort.Strings(sorted)
+	return fmt.Sprintf("[%s]", strings.Join(sorted, ", "))
+}
@@ -0,0 +1,49 @@
+package arpio
+
+import (
+	"reflect"
+	"testing"
+
+	ac "github.com/arpio/arpio-client-go"
+)
+
+func TestDescribeAppChanges(t *testing.T) {
+	from := ac.App{
+		RPO:                3600,
+		SourceAwsAccountID: "123456789012",
+		SourceRegion:       "us-east-1",
+		TargetAwsAccountID: "123456789012",
+		TargetRegion:       "us-west-2",
+		NotificationEmails: []string{"b@example.com", "a@example.com"},
+		SelectionRules: []ac.SelectionRule{
+			ac.NewArnRule([]string{"arn:aws:s3:::a"}),
+			ac.NewTagRule("Team", "a"),
+		},
+	}
+
+	to := from
+	to.NotificationEmails = []string{"a@example.com", "b@example.com"}
+	to.SelectionRules = []ac.SelectionRule{
+		ac.NewTagRule("Team", "a"),
+		ac.NewArnRule([]string{"arn:aws:s3:::a"}),
+	}
+	if changes := describeAppChanges(from, to); len(changes) != 0 {
+		t.Fatalf("expected no changes, got %v", changes)
+	}
+
+	to.RPO = 900
+	to.TargetRegion = "us-east-2"
+	to.SelectionRules = []ac.SelectionRule{
+		ac.NewTagRule("Team", "a"),
+		ac.NewTagRule("Backup", ""),
+	}
+	expected := []string{
+		"rpo: 60 -> 15",
+		"recovery_region: us-west-2 -> us-east-2",
+		"resources: removes ARNs [arn:aws:s3:::a]",
+		"resources: adds tag Backup with any value",
+	}
+	if changes := describeAppChanges(from, to); !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("%v != %v", changes, expected)
+	}
+}
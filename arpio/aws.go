@@ -2,11 +2,181 @@ package arpio
 
 import (
 	"fmt"
+	ac "github.com/arpio/arpio-client-go"
+	"regexp"
 	"strings"
 )
 
-func IsARN(a string) bool {
-	return strings.HasPrefix(a, "arn:") && strings.Count(a, ":") >= 5
+// CloudFormationStackIDTag is the tag CloudFormation applies to the resources
+// it creates.  Its value is the ARN of the stack.
+const CloudFormationStackIDTag = "aws:cloudformation:stack-id"
+
+// AWS partitions that Arpio supports.
+const (
+	AwsPartition         = "aws"
+	AwsChinaPartition    = "aws-cn"
+	AwsGovCloudPartition = "aws-us-gov"
+)
+
+var AwsPartitions = []string{AwsPartition, AwsChinaPartition, AwsGovCloudPartition}
+
+// AwsRegions lists the regions in each partition.
+var AwsRegions = map[string][]string{
+	AwsPartition: {
+		"af-south-1",
+		"ap-east-1",
+		"ap-east-2",
+		"ap-northeast-1",
+		"ap-northeast-2",
+		"ap-northeast-3",
+		"ap-south-1",
+		"ap-south-2",
+		"ap-southeast-1",
+		"ap-southeast-2",
+		"ap-southeast-3",
+		"ap-southeast-4",
+		"ap-southeast-5",
+		"ap-southeast-7",
+		"ca-central-1",
+		"ca-west-1",
+		"eu-central-1",
+		"eu-central-2",
+		"eu-north-1",
+		"eu-south-1",
+		"eu-south-2",
+		"eu-west-1",
+		"eu-west-2",
+		"eu-west-3",
+		"il-central-1",
+		"me-central-1",
+		"me-south-1",
+		"mx-central-1",
+		"sa-east-1",
+		"us-east-1",
+		"us-east-2",
+		"us-west-1",
+		"us-west-2",
+	},
+	AwsChinaPartition: {
+		"cn-north-1",
+		"cn-northwest-1",
+	},
+	AwsGovCloudPartition: {
+		"us-gov-east-1",
+		"us-gov-west-1",
+	},
+}
+
+var (
+	arnServiceRegexp   = regexp.MustCompile(`^[a-z0-9-]+$`)
+	awsAccountIDRegexp = regexp.MustCompile(`^[0-9]{12}$`)
+
+	// cloudFormationStackRegexp matches the resource segment of a stack ARN,
+	// which has the stack's name and unique ID
+	cloudFormationStackRegexp = regexp.MustCompile(`^stack/[a-zA-Z][-a-zA-Z0-9]*/[-a-zA-Z0-9]+$`)
+)
+
+// ARN is an Amazon Resource Name split into its segments.  Region and
+// AccountID are empty for resources whose ARNs don't include them, like S3
+// buckets.
+type ARN struct {
+	Partition string
+	Service   string
+	Region    string
+	AccountID string
+	Resource  string
+}
+
+// ParseARN parses an ARN and validates its segments.
+func ParseARN(a string) (arn ARN, err error) {
+	parts := strings.SplitN(a, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" {
+		return arn, fmt.Errorf("%q is not an ARN; ARNs have the form "+
+			"arn:partition:service:region:account-id:resource", a)
+	}
+	arn = ARN{
+		Partition: parts[1],
+		Service:   parts[2],
+		Region:    parts[3],
+		AccountID: parts[4],
+		Resource:  parts[5],
+	}
+
+	if !ac.SliceContainsString(arn.Partition, AwsPartitions) {
+		return arn, fmt.Errorf("ARN %q has an unknown partition %q; use one of %s",
+			a, arn.Partition, strings.Join(AwsPartitions, ", "))
+	}
+	if !arnServiceRegexp.MatchString(arn.Service) {
+		return arn, fmt.Errorf("ARN %q has an invalid service %q", a, arn.Service)
+	}
+	if arn.Region != "" {
+		if PartitionForRegion(arn.Region) == "" {
+			return arn, fmt.Errorf("ARN %q has an invalid region %q", a, arn.Region)
+		}
+		if PartitionForRegion(arn.Region) != arn.Partition {
+			return arn, fmt.Errorf("ARN %q has region %q, which is not in the %q partition",
+				a, arn.Region, arn.Partition)
+		}
+	}
+	if arn.AccountID != "" && !IsAwsAccountID(arn.AccountID) {
+		return arn, fmt.Errorf("ARN %q has an invalid account ID %q; AWS "+
+			"account IDs are 12 digits", a, arn.AccountID)
+	}
+	if arn.Resource == "" {
+		return arn, fmt.Errorf("ARN %q has no resource", a)
+	}
+
+	return arn, nil
+}
+
+func (a ARN) String() string {
+	return strings.Join([]string{"arn", a.Partition, a.Service, a.Region, a.AccountID, a.Resource}, ":")
+}
+
+// IsCloudFormationStack checks if the ARN is the full ARN of a CloudFormation
+// stack, including the stack ID that follows its name.  This is the form of
+// the ARN that CloudFormation tags stack resources with.
+func (a ARN) IsCloudFormationStack() bool {
+	return a.Service == "cloudformation" && cloudFormationStackRegexp.MatchString(a.Resource)
+}
+
+// PartitionForRegion returns the partition the specified region is in, or ""
+// if the region is unknown.
+func PartitionForRegion(region string) string {
+	for _, partition := range AwsPartitions {
+		if ac.SliceContainsString(region, AwsRegions[partition]) {
+			return partition
+		}
+	}
+	return ""
+}
+
+// IsAwsAccountID checks if id is a 12-digit AWS account ID.
+func IsAwsAccountID(id string) bool {
+	return awsAccountIDRegexp.MatchString(id)
+}
+
+func ValidateAwsAccountID(v interface{}, k string) (ws []string, errors []error) {
+	value := v.(string)
+
+	if !IsAwsAccountID(value) {
+		errors = append(errors, fmt.Errorf("%q (%s) is an invalid AWS account ID; "+
+			"AWS account IDs are 12 digits", k, value))
+		return ws, errors
+	}
+
+	return ws, errors
+}
+
+func ValidateAwsRegion(v interface{}, k string) (ws []string, errors []error) {
+	value := v.(string)
+
+	if PartitionForRegion(value) == "" {
+		errors = append(errors, fmt.Errorf("%q (%s) is not a known AWS region", k, value))
+		return ws, errors
+	}
+
+	return ws, errors
 }
 
 func ValidateArn(v interface{}, k string) (ws []string, errors []error) {
@@ -16,8 +186,29 @@ func ValidateArn(v interface{}, k string) (ws []string, errors []error) {
 		return ws, errors
 	}
 
-	if !IsARN(value) {
-		errors = append(errors, fmt.Errorf("%q (%s) is an invalid ARN", k, value))
+	if _, err := ParseARN(value); err != nil {
+		errors = append(errors, fmt.Errorf("%q: %s", k, err))
+		return ws, errors
+	}
+
+	return ws, errors
+}
+
+func ValidateCloudFormationStackArn(v interface{}, k string) (ws []string, errors []error) {
+	value := v.(string)
+
+	if value == "" {
+		return ws, errors
+	}
+
+	arn, err := ParseARN(value)
+	if err != nil {
+		errors = append(errors, fmt.Errorf("%q: %s", k, err))
+		return ws, errors
+	}
+	if !arn.IsCloudFormationStack() {
+		errors = append(errors, fmt.Errorf("%q (%s) is not a CloudFormation stack ARN; "+
+			"use the full stack ARN, which ends with stack/<name>/<stack ID>", k, value))
 		return ws, errors
 	}
 
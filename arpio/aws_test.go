@@ -0,0 +1,94 @@
+package arpio
+
+import "testing"
+
+func TestParseARN(t *testing.T) {
+	arn, err := ParseARN("arn:aws-us-gov:rds:us-gov-west-1:123456789012:db:site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := ARN{
+		Partition: "aws-us-gov",
+		Service:   "rds",
+		Region:    "us-gov-west-1",
+		AccountID: "123456789012",
+		Resource:  "db:site",
+	}
+	if arn != expected {
+		t.Fatalf("%v != %v", arn, expected)
+	}
+	if arn.String() != "arn:aws-us-gov:rds:us-gov-west-1:123456789012:db:site" {
+		t.Fatalf("unexpected string %s", arn)
+	}
+
+	cases := map[string]bool{
+		"arn:aws:ec2:us-east-1:123456789012:instance/i-abcdefg1234567890": true,
+		"arn:aws:s3:::bucket": true,
+		"arn:aws-cn:dynamodb:cn-north-1:123456789012:table/app": true,
+		"arn:aws:dynamodb:cn-north-1:123456789012:table/app":    false,
+		"arn:aws-gov:dynamodb:us-east-1:123456789012:table/app": false,
+		"arn:aws:Dynamo DB:us-east-1:123456789012:table/app":    false,
+		"arn:aws:dynamodb:us-east1:123456789012:table/app":      false,
+		"arn:aws:dynamodb:us-east-1:12345678901:table/app":      false,
+		"arn:aws:dynamodb:*:123456789012:table/app":             false,
+		"arn:aws:s3:::":       false,
+		"arn:aws:s3::bucket":  false,
+		"not:aws:s3:::bucket": false,
+	}
+	for a, valid := range cases {
+		if _, err := ParseARN(a); (err == nil) != valid {
+			t.Errorf("ParseARN(%q) valid should be %t: %v", a, valid, err)
+		}
+	}
+}
+
+func TestPartitionForRegion(t *testing.T) {
+	cases := map[string]string{
+		"us-east-1":     AwsPartition,
+		"eu-central-2":  AwsPartition,
+		"cn-north-1":    AwsChinaPartition,
+		"us-gov-west-1": AwsGovCloudPartition,
+		"us-east1":      "",
+		"":              "",
+	}
+	for region, expected := range cases {
+		if partition := PartitionForRegion(region); partition != expected {
+			t.Errorf("PartitionForRegion(%q) = %q, expected %q", region, partition, expected)
+		}
+	}
+}
+
+func TestIsCloudFormationStack(t *testing.T) {
+	cases := map[string]bool{
+		"arn:aws:cloudformation:us-east-1:123456789012:stack/site/0f3e2a50-1c1e-11ec-9621-0242ac130002":    true,
+		"arn:aws:cloudformation:us-east-1:123456789012:stack/site":                                         false,
+		"arn:aws:cloudformation:us-east-1:123456789012:stack/site/":                                        false,
+		"arn:aws:cloudformation:us-east-1:123456789012:stackset/site:0f3e2a50-1c1e-11ec-9621-0242ac130002": false,
+		"arn:aws:ec2:us-east-1:123456789012:stack/site/0f3e2a50-1c1e-11ec-9621-0242ac130002":               false,
+	}
+	for a, expected := range cases {
+		arn, err := ParseARN(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if arn.IsCloudFormationStack() != expected {
+			t.Errorf("IsCloudFormationStack(%q) should be %t", a, expected)
+		}
+	}
+}
+
+func TestIsAwsAccountID(t *testing.T) {
+	cases := map[string]bool{
+		"123456789012":  true,
+		"012345678901":  true,
+		"12345678901":   false,
+		"1234567890123": false,
+		"12345678901a":  false,
+		"":              false,
+	}
+	for id, expected := range cases {
+		if IsAwsAccountID(id) != expected {
+			t.Errorf("IsAwsAccountID(%q) should be %t", id, expected)
+		}
+	}
+}
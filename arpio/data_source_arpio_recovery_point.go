@@ -1,18 +1,22 @@
 package arpio
 
 import (
+	"context"
 	"fmt"
 	"github.com/arpio/arpio-client-go"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"log"
 	"time"
 )
 
 func dataSourceArpioRecoveryPoint() *schema.Resource {
-	//goland:noinspection GoDeprecation
 	return &schema.Resource{
-		Read:        dataSourceArpioRecoveryPointRead,
+		ReadContext: dataSourceArpioRecoveryPointRead,
 		Description: "Identifies an Arpio recovery point that can be used to recover stateful resources",
+		Timeouts: &schema.ResourceTimeout{
+			Read: schema.DefaultTimeout(60 * time.Minute),
+		},
 		Schema: map[string]*schema.Schema{
 			"app_id": {
 				Type:        schema.TypeString,
@@ -33,7 +37,7 @@ func dataSourceArpioRecoveryPoint() *schema.Resource {
 				Type:        schema.TypeString,
 				Optional:    true,
 				Default:     0,
-				Description: "Duration to wait for a matching recovery point to exist",
+				Description: "Duration to wait for a matching recovery point to exist, up to the read timeout",
 			},
 			"primary_account_id": {
 				Type:     schema.TypeString,
@@ -63,7 +67,7 @@ func dataSourceArpioRecoveryPoint() *schema.Resource {
 	}
 }
 
-func dataSourceArpioRecoveryPointRead(d *schema.ResourceData, m interface{}) error {
+func dataSourceArpioRecoveryPointRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	am := m.(*ProviderMetadata)
 
 	if d.HasChange("app_id") || d.HasChange("timestamp") || d.HasChange("timestamp_min") {
@@ -71,14 +75,14 @@ func dataSourceArpioRecoveryPointRead(d *schema.ResourceData, m interface{}) err
 
 		app, err := am.Client.GetApp(appID.(string))
 		if err != nil {
-			return err
+			return diag.FromErr(err)
 		}
 
 		syncPair := arpio.NewSyncPair(app.SourceAwsAccountID, app.SourceRegion, app.TargetAwsAccountID, app.TargetRegion)
 
 		timeout, err := time.ParseDuration(d.Get("timeout").(string))
 		if err != nil {
-			return fmt.Errorf("error parsing timeout: %s", err)
+			return diag.Errorf("error parsing timeout: %s", err)
 		}
 
 		timestampMin := d.Get("timestamp_min").(string)
@@ -86,33 +90,54 @@ func dataSourceArpioRecoveryPointRead(d *schema.ResourceData, m interface{}) err
 
 		tsMin, err := ParseRFC3339Timestamp(timestampMin)
 		if err != nil {
-			return err
+			return diag.FromErr(err)
 		}
 		tsMax, err := ParseRFC3339Timestamp(timestampMax)
 		if err != nil {
-			return err
+			return diag.FromErr(err)
 		}
 
-		rp, err := am.Client.MustFindLatestRecoveryPoint(syncPair, tsMin, tsMax, timeout)
+		rp, err := mustFindLatestRecoveryPoint(ctx, am.Client, syncPair, tsMin, tsMax, timeout)
 		if err != nil {
-			return err
+			return diag.FromErr(err)
 		}
 		log.Printf("[INFO] Found recovery point %s at timestamp %s", rp.RecoveryPointID, rp.Timestamp)
 
 		if err := d.Set("primary_account_id", app.SourceAwsAccountID); err != nil {
-			return err
+			return diag.FromErr(err)
 		}
 		if err := d.Set("primary_region", app.SourceRegion); err != nil {
-			return err
+			return diag.FromErr(err)
 		}
 		if err := d.Set("recovery_account_id", app.TargetAwsAccountID); err != nil {
-			return err
+			return diag.FromErr(err)
 		}
 		if err := d.Set("recovery_region", app.TargetRegion); err != nil {
-			return err
+			return diag.FromErr(err)
 		}
 		d.SetId(rp.RecoveryPointID)
 	}
 
 	return nil
 }
+
+// mustFindLatestRecoveryPoint is like Client.MustFindLatestRecoveryPoint, but
+// it stops waiting for a matching recovery point when ctx is done.
+func mustFindLatestRecoveryPoint(ctx context.Context, client *arpio.Client, syncPair arpio.SyncPair, timestampMin, timestampMax *time.Time, timeout time.Duration) (*arpio.RecoveryPoint, error) {
+	for timeoutAt := time.Now().Add(timeout); time.Now().Before(timeoutAt); {
+		rp, err := client.FindLatestRecoveryPoint(syncPair, timestampMin, timestampMax)
+		if err != nil || rp != nil {
+			return rp, err
+		}
+
+		log.Printf("[DEBUG] Waiting for a matching recovery point to exist")
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("error waiting for a matching recovery point: %s", ctx.Err())
+		case <-time.After(arpio.RecoveryPointPollPeriod):
+		}
+	}
+
+	// Look one last time, which explains the error if there's still no match
+	return client.MustFindLatestRecoveryPoint(syncPair, timestampMin, timestampMax, 0)
+}
@@ -0,0 +1,43 @@
+package arpio
+
+import (
+	"fmt"
+	"net/mail"
+	"sort"
+)
+
+// IsEmailAddress checks if s is a plain RFC 5322 email address, without a
+// display name or angle brackets.
+func IsEmailAddress(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s
+}
+
+func ValidateEmailAddress(v interface{}, k string) (ws []string, errors []error) {
+	value := v.(string)
+
+	if !IsEmailAddress(value) {
+		errors = append(errors, fmt.Errorf("%q (%s) is an invalid email address; "+
+			"use a plain address like \"admin@example.com\"", k, value))
+		return ws, errors
+	}
+
+	return ws, errors
+}
+
+// MergeEmailAddresses returns the sorted union of the email address lists,
+// without duplicates.
+func MergeEmailAddresses(lists ...[]string) []string {
+	seen := map[string]bool{}
+	merged := []string{}
+	for _, list := range lists {
+		for _, email := range list {
+			if !seen[email] {
+				seen[email] = true
+				merged = append(merged, email)
+			}
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
@@ -0,0 +1,35 @@
+package arpio
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsEmailAddress(t *testing.T) {
+	cases := map[string]bool{
+		"admin@example.com":              true,
+		"first.last+dr@mail.example.com": true,
+		"Admin <admin@example.com>":      false,
+		"<admin@example.com>":            false,
+		"admin@":                         false,
+		"admin":                          false,
+		"":                               false,
+	}
+	for email, valid := range cases {
+		if IsEmailAddress(email) != valid {
+			t.Errorf("IsEmailAddress(%q) should be %t", email, valid)
+		}
+	}
+}
+
+func TestMergeEmailAddresses(t *testing.T) {
+	merged := MergeEmailAddresses(
+		[]string{"b@example.com", "a@example.com"},
+		[]string{"c@example.com", "a@example.com"},
+		nil,
+	)
+	expected := []string{"a@example.com", "b@example.com", "c@example.com"}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Fatalf("%v != %v", merged, expected)
+	}
+}
@@ -8,7 +8,8 @@ import (
 )
 
 type ProviderMetadata struct {
-	Client *ac.Client
+	Client                    *ac.Client
+	DefaultNotificationEmails []string
 }
 
 func Provider() *schema.Provider {
@@ -41,6 +42,15 @@ func Provider() *schema.Provider {
 				Description: "Arpio account that protects and recovers stateful resources",
 				DefaultFunc: schema.EnvDefaultFunc(ArpioAccountIDEnv, nil),
 			},
+			"default_notification_emails": {
+				Type:        schema.TypeSet,
+				Optional:    true,
+				Description: "Email addresses that receive notification emails for every app, in addition to each app's notification_emails",
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: ValidateEmailAddress,
+				},
+			},
 		},
 		DataSourcesMap: map[string]*schema.Resource{
 			"arpio_recovery_point": dataSourceArpioRecoveryPoint(),
@@ -73,7 +83,8 @@ func arpioConfigure(d *schema.ResourceData) (m interface{}, err error) {
 	}
 
 	metadata := &ProviderMetadata{
-		Client: client,
+		Client:                    client,
+		DefaultNotificationEmails: MergeEmailAddresses(FromSetToStringList(d.Get("default_notification_emails"))),
 	}
 	return metadata, nil
 }
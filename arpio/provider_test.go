@@ -82,6 +82,32 @@ func testAccCleanupApps(name string) {
 	}
 }
 
+// testAccProviderConfig returns the provider block for acceptance test
+// configs, with connection information from the environment.
+func testAccProviderConfig() string {
+	return testAccProviderConfigWith("")
+}
+
+// testAccProviderConfigWith returns the provider block for acceptance test
+// configs with additional provider arguments.
+func testAccProviderConfigWith(args string) string {
+	return fmt.Sprintf(`
+		provider "arpio" {
+			account_id     = "%s"
+			api_key_id     = "%s"
+			api_key_secret = "%s"
+			api_url        = "%s"
+			%s
+		}
+		`,
+		os.Getenv(ArpioAccountIDEnv),
+		os.Getenv(ArpioApiKeyIDEnv),
+		os.Getenv(ArpioApiKeySecretEnv),
+		os.Getenv(ArpioApiURLEnv),
+		args,
+	)
+}
+
 func checkAttrString(rs *terraform.ResourceState, attrName, expectedValue string) error {
 	v := rs.Primary.Attributes[attrName]
 	if v != expectedValue {
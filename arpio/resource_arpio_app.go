@@ -1,56 +1,234 @@
 package arpio
 
 import (
+	"context"
 	"fmt"
 	ac "github.com/arpio/arpio-client-go"
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
-	"sort"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// appImportNamePrefix is the import ID prefix that selects an app by name
+// instead of by ID.
+const appImportNamePrefix = "name:"
+
+// UnmanageableAppFields are the optional arpio_app attributes that can be
+// listed in unmanaged_fields.
+var UnmanageableAppFields = []string{"notification_emails", "resources"}
+
+// Values of on_existing, which decides what creating an app does when an app
+// with the same name already exists.
+const (
+	OnExistingAdopt           = "adopt"
+	OnExistingAdoptIfMatching = "adopt_if_matching"
+	OnExistingError           = "error"
+)
+
+// syncPairFields are the arpio_app attributes that make up its sync pair.
+var syncPairFields = []string{"primary_account_id", "primary_region", "recovery_account_id", "recovery_region"}
+
+// appFields are the arpio_app attributes that are sent to Arpio.  The other
+// arguments only change how the provider manages the app.
+var appFields = append([]string{
+	"name",
+	"rpo",
+	"notification_emails",
+	"notification_emails_all",
+	"resources",
+	"unmanaged_fields",
+}, syncPairFields...)
+
+// recoveryPointStatusFields are the computed arpio_app attributes that
+// describe the recovery points of its sync pair.
+var recoveryPointStatusFields = []string{
+	"latest_recovery_point_id",
+	"last_sync_time",
+	"protected_resource_count",
+	"rpo_compliant",
+}
+
+// Values of on_destroy, which decides what destroying an app does.
+const (
+	OnDestroyAbandon = "abandon"
+	OnDestroyDelete  = "delete"
 )
 
 func resourceArpioApp() *schema.Resource {
-	//goland:noinspection GoDeprecation
 	return &schema.Resource{
-		Create: resourceArpioAppCreate,
-		Read:   resourceArpioAppRead,
-		Update: resourceArpioAppUpdate,
-		Delete: resourceArpioAppDelete,
+		CreateContext: resourceArpioAppCreate,
+		ReadContext:   resourceArpioAppRead,
+		UpdateContext: resourceArpioAppUpdate,
+		DeleteContext: resourceArpioAppDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: resourceArpioAppImport,
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(60 * time.Minute),
+			Read:   schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(60 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
+		SchemaVersion: 1,
+		StateUpgraders: []schema.StateUpgrader{
+			{
+				Version: 0,
+				Type:    resourceArpioAppV0().CoreConfigSchema().ImpliedType(),
+				Upgrade: resourceArpioAppStateUpgradeV0,
+			},
+		},
+		CustomizeDiff: customdiff.All(
+			resourceArpioAppCustomizeDiffSyncPair,
+			resourceArpioAppCustomizeDiffSyncPairChange,
+			resourceArpioAppCustomizeDiffNotificationEmails,
+			resourceArpioAppCustomizeDiffResources,
+			customdiff.ComputedIf("protected_resource_count", func(_ context.Context, d *schema.ResourceDiff, _ interface{}) bool {
+				return d.HasChange("count_protected_resources")
+			}),
+		),
 		Schema: map[string]*schema.Schema{
 			"name": {
-				Type:     schema.TypeString,
-				Required: true,
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				Description:  "Name of the app; either name or name_prefix must be set",
+				ExactlyOneOf: []string{"name", "name_prefix"},
+			},
+			"name_prefix": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				Description:  "Creates an app with a unique name beginning with this prefix, so it never adopts an existing app",
+				ExactlyOneOf: []string{"name", "name_prefix"},
 			},
 			"rpo": {
-				Type:     schema.TypeInt,
-				Required: true,
+				Type:             schema.TypeString,
+				Required:         true,
+				Description:      "Recovery point objective, as a number of minutes or a duration like \"15m\" or \"1h\"",
+				ValidateFunc:     ValidateRPO,
+				DiffSuppressFunc: SuppressEquivalentRPO,
 			},
 			"primary_account_id": {
-				Type:     schema.TypeString,
-				Required: true,
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: ValidateAwsAccountID,
 			},
 			"primary_region": {
-				Type:     schema.TypeString,
-				Required: true,
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: ValidateAwsRegion,
 			},
 			"recovery_account_id": {
-				Type:     schema.TypeString,
-				Required: true,
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: ValidateAwsAccountID,
 			},
 			"recovery_region": {
-				Type:     schema.TypeString,
-				Required: true,
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: ValidateAwsRegion,
 			},
 			"notification_emails": {
-				Type:        schema.TypeList,
+				Type:        schema.TypeSet,
 				Optional:    true,
 				Description: "Email address of Arpio users who wish to receive notification emails",
 				Elem: &schema.Schema{
-					Type: schema.TypeString,
+					Type:         schema.TypeString,
+					ValidateFunc: ValidateEmailAddress,
 				},
+				DiffSuppressFunc: suppressUnmanagedFieldDiff("notification_emails"),
 			},
-			"resources": {
+			"notification_emails_all": {
 				Type:        schema.TypeSet,
+				Computed:    true,
+				Description: "Email addresses that receive notification emails, including the provider's default_notification_emails",
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"on_existing": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Default:  OnExistingAdopt,
+				Description: "What to do on creation when an Arpio app with the same name already exists: " +
+					"\"adopt\" updates it to match the config, \"adopt_if_matching\" adopts it only if it " +
+					"already matches the config, and \"error\" fails",
+				ValidateFunc: validation.StringInSlice([]string{
+					OnExistingAdopt,
+					OnExistingAdoptIfMatching,
+					OnExistingError,
+				}, false),
+			},
+			"wait_for_first_recovery_point": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+				Description: "Wait on create and update until a recovery point has been created since the app was " +
+					"created and the latest recovery point is within the RPO.  The wait is limited by the " +
+					"create and update timeouts",
+			},
+			"count_protected_resources": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+				Description: "Count the resources in the latest recovery point on every refresh to set " +
+					"protected_resource_count.  Counting downloads the recovery point's full resource list, " +
+					"so it is off by default",
+			},
+			"replace_on_sync_pair_change": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+				Description: "Replace the app when its primary or recovery account ID or region changes.  " +
+					"Recovery points belong to the primary and recovery environments, so either way the app " +
+					"no longer sees the recovery points of its previous environments.  The replacement can't " +
+					"be planned when on_destroy is \"abandon\".  With create_before_destroy, the replacement " +
+					"is created while the old app still exists, so give the app a name_prefix instead of a " +
+					"name; a replacement with the same name fails rather than adopting the old app",
+			},
+			"deletion_protection": {
+				Type:        schema.TypeBool,
 				Optional:    true,
-				Description: "Specifies rules for matching resources to protect",
+				Default:     false,
+				Description: "Prevent Terraform from destroying the app; set to false and apply before destroying it",
+			},
+			"on_destroy": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Default:  OnDestroyDelete,
+				Description: "What destroying the app does: \"delete\" deletes the app from Arpio, and \"abandon\" " +
+					"only removes it from the Terraform state so it keeps protecting resources",
+				ValidateFunc: validation.StringInSlice([]string{
+					OnDestroyAbandon,
+					OnDestroyDelete,
+				}, false),
+			},
+			"unmanaged_fields": {
+				Type:     schema.TypeSet,
+				Optional: true,
+				Description: "Optional fields that Terraform leaves as they are in Arpio, so they can be managed " +
+					"in the Arpio web interface: \"notification_emails\", \"resources\" or both.  Terraform " +
+					"always manages name, rpo and the primary and recovery account IDs and regions, and it " +
+					"manages notification_emails and resources unless they are listed here.  Managed fields that " +
+					"aren't set in the config are cleared on the app",
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validation.StringInSlice(UnmanageableAppFields, false),
+				},
+			},
+			"resources": {
+				Type:             schema.TypeSet,
+				Optional:         true,
+				Description:      "Specifies rules for matching resources to protect; a resource is protected if it matches any block",
+				DiffSuppressFunc: suppressUnmanagedFieldDiff("resources"),
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
 						"arns": {
@@ -58,7 +236,17 @@ func resourceArpioApp() *schema.Resource {
 							Optional:    true,
 							Description: "ARNs of stateful resources that Arpio should protect",
 							Elem: &schema.Schema{
-								Type: schema.TypeString,
+								Type:         schema.TypeString,
+								ValidateFunc: ValidateArn,
+							},
+						},
+						"cloudformation_stacks": {
+							Type:        schema.TypeSet,
+							Optional:    true,
+							Description: "ARNs of CloudFormation stacks whose stateful resources Arpio should protect",
+							Elem: &schema.Schema{
+								Type:         schema.TypeString,
+								ValidateFunc: ValidateCloudFormationStackArn,
 							},
 						},
 						"tags": {
@@ -69,151 +257,613 @@ func resourceArpioApp() *schema.Resource {
 								Type: schema.TypeString,
 							},
 						},
+						"tag_rule": {
+							Type:        schema.TypeSet,
+							Optional:    true,
+							Description: "Tag key and values matching stateful resources that Arpio should protect",
+							Elem: &schema.Resource{
+								Schema: map[string]*schema.Schema{
+									"key": {
+										Type:         schema.TypeString,
+										Required:     true,
+										Description:  "Tag key to match",
+										ValidateFunc: validation.StringIsNotEmpty,
+									},
+									"values": {
+										Type:        schema.TypeSet,
+										Optional:    true,
+										Description: "Tag values to match; resources with any of the values match",
+										Elem: &schema.Schema{
+											Type:         schema.TypeString,
+											ValidateFunc: validation.StringIsNotEmpty,
+										},
+									},
+									"exists": {
+										Type:        schema.TypeBool,
+										Optional:    true,
+										Description: "Match resources that have the tag key with any value",
+									},
+								},
+							},
+						},
 					},
 				},
 			},
+			"status": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "Sync phase of the app, as shown in the Arpio web interface",
+			},
+			"created_at": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "Time the app was created (RFC 3339 format)",
+			},
+			"latest_recovery_point_id": {
+				Type:     schema.TypeString,
+				Computed: true,
+				Description: "ID of the latest recovery point for the app's primary and recovery environments. " +
+					"Only recovery points from the last " + strconv.Itoa(recoveryPointLookupRPOs) + " RPOs are " +
+					"considered, so this is empty when there are none",
+			},
+			"last_sync_time": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "Timestamp of the latest recovery point (RFC 3339 format)",
+			},
+			"protected_resource_count": {
+				Type:        schema.TypeInt,
+				Computed:    true,
+				Description: "Number of resources in the latest recovery point, or 0 unless count_protected_resources is set",
+			},
+			"rpo_compliant": {
+				Type:        schema.TypeBool,
+				Computed:    true,
+				Description: "Whether the latest recovery point is within the RPO as of the last refresh",
+			},
 		},
 	}
 }
 
-func resourceArpioAppCreate(d *schema.ResourceData, m interface{}) error {
+func resourceArpioAppCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	am := m.(*ProviderMetadata)
 
+	if prefix, ok := d.GetOk("name_prefix"); ok {
+		if err := d.Set("name", resource.PrefixedUniqueId(prefix.(string))); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
 	app := am.Client.NewApp()
-	if err := setAppFromResourceData(d, &app); err != nil {
-		return err
+	if err := setAppFromResourceData(d, &app, am.DefaultNotificationEmails); err != nil {
+		return diag.FromErr(err)
 	}
 
-	// If an application with the same name already exists, we'll update it
-	// to match the resource's config and use it.  If there are multiple apps
-	// with the same name, we'll fail the create and let the user sort it out.
+	// If an application with the same name already exists, on_existing
+	// decides whether we update it to match the resource's config and use it.
+	// If there are multiple apps with the same name, we'll fail the create and
+	// let the user sort it out.
 	apps, err := am.Client.ListApps()
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
-	var existingAppID string
-	for _, existingApp := range apps {
-		if existingApp.Name == app.Name {
-			if existingAppID != "" {
-				return fmt.Errorf("more than one Arpio app already "+
+	var existingApp *ac.App
+	for i := range apps {
+		if apps[i].Name == app.Name {
+			if existingApp != nil {
+				return diag.Errorf("more than one Arpio app already "+
 					"exists with the name %q; use the Arpio web interface to "+
 					"rename the unrelated apps, then retry the creation",
 					app.Name)
 			}
-			existingAppID = existingApp.AppID
+			existingApp = &apps[i]
 		}
 	}
 
-	if existingAppID != "" {
+	if existingApp != nil {
+		// A replacement forced by a sync pair change must not adopt the app
+		// it replaces, which still exists with create_before_destroy
+		if d.Get("replace_on_sync_pair_change").(bool) && existingApp.SyncPair() != app.SyncPair() {
+			return diag.Errorf("an Arpio app named %q already exists with "+
+				"a different sync pair (%s); replace_on_sync_pair_change is "+
+				"set, so it is not adopted.  If this app is replacing it "+
+				"with create_before_destroy, use name_prefix so the "+
+				"replacement gets a new name", app.Name, existingApp.SyncPair())
+		}
+
+		adopted := *existingApp
+		if err := setAppFromResourceData(d, &adopted, am.DefaultNotificationEmails); err != nil {
+			return diag.FromErr(err)
+		}
+		changes := describeAppChanges(*existingApp, adopted)
+
+		switch d.Get("on_existing").(string) {
+		case OnExistingError:
+			return diag.Errorf("an Arpio app named %q already exists; "+
+				"import it with \"terraform import\" or set on_existing "+
+				"to %q to adopt it", app.Name, OnExistingAdopt)
+		case OnExistingAdoptIfMatching:
+			if len(changes) > 0 {
+				return diag.Diagnostics{{
+					Severity: diag.Error,
+					Summary:  fmt.Sprintf("Arpio app %q already exists with different settings", app.Name),
+					Detail: "on_existing is " + OnExistingAdoptIfMatching +
+						", so the app is only adopted if it already matches " +
+						"the config.  Adopting it would make these changes:\n\n" +
+						strings.Join(changes, "\n"),
+					AttributePath: cty.GetAttrPath("on_existing"),
+				}}
+			}
+		}
+
 		// Update the existing app
-		d.SetId(existingAppID)
-		return resourceArpioAppUpdate(d, m)
+		var diags diag.Diagnostics
+		if len(changes) > 0 {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  fmt.Sprintf("Adopted existing Arpio app %q", app.Name),
+				Detail: "An Arpio app with this name already existed, so it " +
+					"was updated to match the config.  These changes were " +
+					"made to it:\n\n" + strings.Join(changes, "\n"),
+			})
+		}
+		d.SetId(existingApp.AppID)
+		return append(diags, resourceArpioAppUpdate(ctx, d, m)...)
 	} else {
 		// Create a new app
 		createdApp, err := am.Client.CreateApp(app)
 		if err != nil {
-			return err
+			return diag.FromErr(err)
 		}
 		d.SetId(createdApp.AppID)
-		return setResourceDataFromApp(d, app)
+		if err := setResourceDataFromApp(d, app, am.DefaultNotificationEmails); err != nil {
+			return diag.FromErr(err)
+		}
+		diags := setResourceDataStatusFromApp(ctx, d, am.Client, createdApp)
+		if diags.HasError() {
+			return diags
+		}
+		return append(diags, resourceArpioAppWaitForProtection(ctx, d, am.Client, createdApp)...)
 	}
 }
 
-func resourceArpioAppRead(d *schema.ResourceData, m interface{}) error {
+func resourceArpioAppRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	am := m.(*ProviderMetadata)
 
 	app, err := am.Client.GetApp(d.Id())
 	if err != nil {
-		return err
+		return diag.FromErr(err)
+	}
+	// The client takes no context, so check for a timeout between calls
+	if err := ctx.Err(); err != nil {
+		return diag.Errorf("error reading Arpio app %s: %s", d.Id(), err)
 	}
 
-	if app.AppID == "" {
+	if app == nil || app.AppID == "" {
 		d.SetId("")
 		return nil
 	}
 
-	return setResourceDataFromApp(d, *app)
+	if err := setResourceDataFromApp(d, *app, am.DefaultNotificationEmails); err != nil {
+		return diag.FromErr(err)
+	}
+	return setResourceDataStatusFromApp(ctx, d, am.Client, *app)
 }
 
-func resourceArpioAppUpdate(d *schema.ResourceData, m interface{}) error {
+func resourceArpioAppUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	am := m.(*ProviderMetadata)
 
+	// Changes to the provider's own arguments, like on_destroy, only need
+	// to be saved in the state.  Adopted apps are always updated.
+	if !d.IsNewResource() && !d.HasChanges(appFields...) {
+		// Counting protected resources or not only changes the status
+		if d.HasChange("count_protected_resources") {
+			return resourceArpioAppRead(ctx, d, m)
+		}
+		return nil
+	}
+
 	app, err := am.Client.GetApp(d.Id())
 	if err != nil {
-		return err
+		return diag.FromErr(err)
+	}
+	if app == nil || app.AppID == "" {
+		return diag.Errorf("Arpio app %s no longer exists", d.Id())
+	}
+
+	// The API doesn't version apps, so detect changes made outside Terraform
+	// since the app was last read by comparing it with the prior state.
+	// Adopted apps have no prior state to compare with.
+	if !d.IsNewResource() {
+		if diags := checkAppUnchangedSinceRead(d, *app); diags.HasError() {
+			return diags
+		}
 	}
 
-	err = setAppFromResourceData(d, app)
+	previousSyncPair := app.SyncPair()
+	err = setAppFromResourceData(d, app, am.DefaultNotificationEmails)
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	updated, err := am.Client.UpdateApp(*app)
 	if err != nil {
-		return err
+		return diag.FromErr(err)
+	}
+
+	var diags diag.Diagnostics
+	if !d.IsNewResource() && updated.SyncPair() != previousSyncPair {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  fmt.Sprintf("Arpio app %q moved to a new sync pair", updated.Name),
+			Detail: fmt.Sprintf("The app now syncs %s.  Recovery points "+
+				"belong to a sync pair, so the recovery points of %s are no "+
+				"longer reported as the app's recovery points.  Set "+
+				"replace_on_sync_pair_change to replace the app instead.",
+				updated.SyncPair(), previousSyncPair),
+		})
+	}
+
+	if err := setResourceDataFromApp(d, updated, am.DefaultNotificationEmails); err != nil {
+		return append(diags, diag.FromErr(err)...)
+	}
+	diags = append(diags, setResourceDataStatusFromApp(ctx, d, am.Client, updated)...)
+	if diags.HasError() {
+		return diags
+	}
+	return append(diags, resourceArpioAppWaitForProtection(ctx, d, am.Client, updated)...)
+}
+
+// resourceArpioAppWaitForProtection waits for the app to be protected if
+// wait_for_first_recovery_point is set, and then refreshes its status.
+func resourceArpioAppWaitForProtection(ctx context.Context, d *schema.ResourceData, client *ac.Client, app ac.App) diag.Diagnostics {
+	if !d.Get("wait_for_first_recovery_point").(bool) {
+		return nil
+	}
+	if _, err := waitForProtection(ctx, client, app); err != nil {
+		return diag.FromErr(err)
+	}
+	return setResourceDataStatusFromApp(ctx, d, client, app)
+}
+
+// waitForProtection waits until the app's sync pair has a recovery point
+// created since the app was created, and the latest recovery point is within
+// the app's RPO.  It stops waiting when ctx is done.
+func waitForProtection(ctx context.Context, client *ac.Client, app ac.App) (*ac.RecoveryPoint, error) {
+	var createdAt *time.Time
+	if !app.CreatedAt.IsZero() {
+		createdAt = &app.CreatedAt
+	}
+	for {
+		rp, err := client.FindLatestRecoveryPoint(app.SyncPair(), createdAt, nil)
+		if err != nil {
+			return nil, err
+		}
+		if rp != nil && isRPOCompliant(rp, app.RPO, time.Now()) {
+			log.Printf("[INFO] Arpio app %s is protected by recovery point %s", app.AppID, rp.RecoveryPointID)
+			return rp, nil
+		}
+
+		log.Printf("[DEBUG] Waiting for a recovery point for Arpio app %s", app.AppID)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("error waiting for the first recovery point "+
+				"of Arpio app %s: %s", app.AppID, ctx.Err())
+		case <-time.After(ac.RecoveryPointPollPeriod):
+		}
+	}
+}
+
+// checkAppUnchangedSinceRead returns an error diagnostic if the app differs
+// from the prior state, which means it was changed outside Terraform since
+// Terraform last read it, and an update would overwrite those changes.
+func checkAppUnchangedSinceRead(d *schema.ResourceData, app ac.App) diag.Diagnostics {
+	prior := PriorState{d}
+	lastRead := app
+	if err := setAppFromResourceData(prior, &lastRead, nil); err != nil {
+		log.Printf("[WARN] Not checking app %s for conflicting changes; "+
+			"the prior state is invalid: %s", app.AppID, err)
+		return nil
+	}
+	// The provider's default emails may have changed since the read, so
+	// compare with the emails the app had then
+	if !isUnmanagedField(prior, "notification_emails") {
+		lastRead.NotificationEmails = MergeEmailAddresses(FromSetToStringList(prior.Get("notification_emails_all")))
+	}
+
+	changes := describeAppChanges(lastRead, app)
+	if len(changes) == 0 {
+		return nil
 	}
 
-	return setResourceDataFromApp(d, updated)
+	return diag.Diagnostics{{
+		Severity: diag.Error,
+		Summary:  fmt.Sprintf("Arpio app %q was changed outside Terraform", app.Name),
+		Detail: "The app changed after Terraform last read it, and applying " +
+			"the config would overwrite these changes:\n\n" +
+			strings.Join(changes, "\n") + "\n\n" +
+			"Run terraform plan or apply again to review the app as it is now.",
+	}}
 }
 
-func resourceArpioAppDelete(d *schema.ResourceData, m interface{}) error {
+func resourceArpioAppDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	am := m.(*ProviderMetadata)
-	return am.Client.DeleteApp(d.Id())
+
+	if d.Get("deletion_protection").(bool) {
+		return diag.Diagnostics{{
+			Severity: diag.Error,
+			Summary:  fmt.Sprintf("Arpio app %q has deletion protection", d.Get("name").(string)),
+			Detail: "Set deletion_protection to false and apply the change " +
+				"before destroying the app.",
+			AttributePath: cty.GetAttrPath("deletion_protection"),
+		}}
+	}
+
+	if d.Get("on_destroy").(string) == OnDestroyAbandon {
+		log.Printf("[INFO] Abandoning Arpio app %s; it is only removed from the Terraform state", d.Id())
+		return nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return diag.Errorf("error deleting Arpio app %s: %s", d.Id(), err)
+	}
+	return diag.FromErr(am.Client.DeleteApp(d.Id()))
 }
 
-func setAppFromResourceData(d *schema.ResourceData, app *ac.App) error {
-	emails := TypifyStringList(d.Get("notification_emails").([]interface{}))
-	sort.Strings(emails)
+// resourceArpioAppImport finds the app to import by ID or, when the import ID
+// has the form "name:<app name>", by name.  Read populates the rest of the
+// state after the ID is set.
+func resourceArpioAppImport(_ context.Context, d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+	am := m.(*ProviderMetadata)
 
-	app.Name = d.Get("name").(string)
-	app.RPO = d.Get("rpo").(int) * 60
-	app.SourceAwsAccountID = d.Get("primary_account_id").(string)
-	app.SourceRegion = d.Get("primary_region").(string)
-	app.TargetAwsAccountID = d.Get("recovery_account_id").(string)
-	app.TargetRegion = d.Get("recovery_region").(string)
-	app.NotificationEmails = emails
-	if err := setAppSelectionRulesFromResourceData(d, app); err != nil {
-		return err
+	var app *ac.App
+	var err error
+	if strings.HasPrefix(d.Id(), appImportNamePrefix) {
+		name := strings.TrimPrefix(d.Id(), appImportNamePrefix)
+		app, err = am.Client.GetAppByName(name)
+		if err != nil {
+			return nil, err
+		}
+		if app == nil {
+			return nil, fmt.Errorf("there is no Arpio app named %q", name)
+		}
+	} else {
+		app, err = am.Client.GetApp(d.Id())
+		if err != nil {
+			return nil, err
+		}
+		if app == nil || app.AppID == "" {
+			return nil, fmt.Errorf("there is no Arpio app with ID %q; "+
+				"to import an app by name, use the ID %q",
+				d.Id(), appImportNamePrefix+"<app name>")
+		}
+	}
+
+	d.SetId(app.AppID)
+	if err := d.Set("on_existing", OnExistingAdopt); err != nil {
+		return nil, err
+	}
+	if err := d.Set("wait_for_first_recovery_point", false); err != nil {
+		return nil, err
+	}
+	if err := d.Set("count_protected_resources", false); err != nil {
+		return nil, err
+	}
+	if err := d.Set("deletion_protection", false); err != nil {
+		return nil, err
+	}
+	if err := d.Set("on_destroy", OnDestroyDelete); err != nil {
+		return nil, err
+	}
+	if err := d.Set("replace_on_sync_pair_change", false); err != nil {
+		return nil, err
+	}
+	return []*schema.ResourceData{d}, nil
+}
+
+// resourceArpioAppCustomizeDiffSyncPair checks that the primary and recovery
+// environments can form a sync pair.
+func resourceArpioAppCustomizeDiffSyncPair(_ context.Context, d *schema.ResourceDiff, _ interface{}) error {
+	for _, k := range syncPairFields {
+		if !d.NewValueKnown(k) {
+			return nil
+		}
 	}
+	primaryAccountID := d.Get("primary_account_id").(string)
+	primaryRegion := d.Get("primary_region").(string)
+	recoveryAccountID := d.Get("recovery_account_id").(string)
+	recoveryRegion := d.Get("recovery_region").(string)
+
+	primaryPartition := PartitionForRegion(primaryRegion)
+	recoveryPartition := PartitionForRegion(recoveryRegion)
+	if primaryPartition != recoveryPartition {
+		return fmt.Errorf("recovery_region: %s is in the %s partition, but "+
+			"primary_region %s is in the %s partition; Arpio can only recover "+
+			"within a partition", recoveryRegion, recoveryPartition,
+			primaryRegion, primaryPartition)
+	}
+
+	if primaryAccountID == recoveryAccountID && primaryRegion == recoveryRegion {
+		return fmt.Errorf("recovery_account_id, recovery_region: the recovery "+
+			"environment (%s/%s) must differ from the primary environment in "+
+			"account, region or both", recoveryAccountID, recoveryRegion)
+	}
+
 	return nil
 }
 
-func setAppSelectionRulesFromResourceData(d *schema.ResourceData, app *ac.App) error {
-	var rules []ac.SelectionRule
+// resourceArpioAppCustomizeDiffSyncPairChange plans the effect of changing the
+// sync pair of an existing app: the app is replaced if
+// replace_on_sync_pair_change is set, and otherwise its recovery point status
+// becomes unknown until the app is updated.
+func resourceArpioAppCustomizeDiffSyncPairChange(_ context.Context, d *schema.ResourceDiff, _ interface{}) error {
+	if d.Id() == "" {
+		return nil
+	}
 
-	if attrs, ok := GetFirstElementAsMap(d.Get("resources")); ok {
-		// Include one ARN rule that covers all the specified ARNs
-		arns := FromSetToStringList(attrs["arns"])
-		if len(arns) > 0 {
-			for _, arn := range arns {
-				if !IsARN(arn) {
-					return fmt.Errorf("%q is not a valid ARN ", arn)
-				}
+	var changed []string
+	for _, k := range syncPairFields {
+		if d.HasChange(k) {
+			changed = append(changed, k)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	if d.Get("replace_on_sync_pair_change").(bool) {
+		// The replacement is created with the same name, so if the old app
+		// were abandoned instead of deleted, the replacement would adopt it
+		oldOnDestroy, newOnDestroy := d.GetChange("on_destroy")
+		if oldOnDestroy == OnDestroyAbandon || newOnDestroy == OnDestroyAbandon {
+			return fmt.Errorf("%s changed, so replace_on_sync_pair_change "+
+				"would replace the app, but on_destroy is %q, which leaves "+
+				"the old app in Arpio; set on_destroy to %q or unset "+
+				"replace_on_sync_pair_change", strings.Join(changed, ", "),
+				OnDestroyAbandon, OnDestroyDelete)
+		}
+		for _, k := range changed {
+			if err := d.ForceNew(k); err != nil {
+				return err
 			}
-			sort.Strings(arns)
-			rules = append(rules, ac.NewArnRule(arns))
 		}
+		return nil
+	}
+	for _, k := range recoveryPointStatusFields {
+		if err := d.SetNewComputed(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resourceArpioAppCustomizeDiffNotificationEmails plans notification_emails_all
+// as notification_emails merged with the provider's default emails.
+func resourceArpioAppCustomizeDiffNotificationEmails(_ context.Context, d *schema.ResourceDiff, m interface{}) error {
+	if isUnmanagedField(d, "notification_emails") {
+		return nil
+	}
+	// Addresses from other resources may not be known until apply
+	if !SetValueKnown(d, "notification_emails") {
+		return d.SetNewComputed("notification_emails_all")
+	}
 
-		// Include one tag rule for each key and value
-		tags := FromSetToStringMap(attrs["tags"])
-		if len(tags) > 0 {
-			for k, v := range tags {
-				rules = append(rules, ac.NewTagRule(k, v))
+	var defaultEmails []string
+	if am, ok := m.(*ProviderMetadata); ok {
+		defaultEmails = am.DefaultNotificationEmails
+	}
+	emails := MergeEmailAddresses(FromSetToStringList(d.Get("notification_emails")), defaultEmails)
+	if StringListsEqual(emails, MergeEmailAddresses(FromSetToStringList(d.Get("notification_emails_all")))) {
+		return nil
+	}
+	return d.SetNew("notification_emails_all", UntypifyStringList(emails))
+}
+
+// resourceArpioAppCustomizeDiffResources checks the resources blocks for
+// errors that attribute validation can't detect.
+func resourceArpioAppCustomizeDiffResources(_ context.Context, d *schema.ResourceDiff, _ interface{}) error {
+	// Values from other resources may not be known until apply
+	if !SetValueKnown(d, "resources") || isUnmanagedField(d, "resources") {
+		return nil
+	}
+	checkLocations := d.NewValueKnown("primary_account_id") && d.NewValueKnown("primary_region")
+	accountID := d.Get("primary_account_id").(string)
+	region := d.Get("primary_region").(string)
+
+	// Sets leave out elements with no values, so an empty block only shows
+	// up in the count
+	resources := d.Get("resources").(*schema.Set)
+	if d.Get("resources.#").(int) > resources.Len() {
+		return errEmptyResourcesBlock
+	}
+	blocks := resources.List()
+	if err := checkResourcesBlocks(blocks); err != nil {
+		return err
+	}
+	for _, block := range blocks {
+		attrs := block.(map[string]interface{})
+
+		if checkLocations {
+			arns := append(FromSetToStringList(attrs["arns"]), FromSetToStringList(attrs["cloudformation_stacks"])...)
+			for _, a := range arns {
+				// Malformed ARNs are reported by the attribute validation
+				arn, err := ParseARN(a)
+				if err != nil {
+					continue
+				}
+				if err := validateArnInPrimary(arn, accountID, region); err != nil {
+					return err
+				}
 			}
 		}
 	}
+	return nil
+}
+
+// setAppFromResourceData sets the fields of the app that Terraform manages,
+// merging notification_emails with the provider's default emails.  Fields
+// listed in unmanaged_fields keep the values the app already has.
+func setAppFromResourceData(d AttributeGetter, app *ac.App, defaultEmails []string) error {
+	rpo, err := ParseRPO(d.Get("rpo").(string))
+	if err != nil {
+		return err
+	}
 
-	app.SelectionRules = rules
+	app.Name = d.Get("name").(string)
+	app.RPO = int(rpo / time.Second)
+	app.SourceAwsAccountID = d.Get("primary_account_id").(string)
+	app.SourceRegion = d.Get("primary_region").(string)
+	app.TargetAwsAccountID = d.Get("recovery_account_id").(string)
+	app.TargetRegion = d.Get("recovery_region").(string)
+	if !isUnmanagedField(d, "notification_emails") {
+		// notification_emails_all is only planned, and is unknown at apply
+		// when notification_emails was unknown at plan
+		app.NotificationEmails = MergeEmailAddresses(FromSetToStringList(d.Get("notification_emails")), defaultEmails)
+	}
+	if !isUnmanagedField(d, "resources") {
+		if err := setAppSelectionRulesFromResourceData(d, app); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func setResourceDataFromApp(d *schema.ResourceData, app ac.App) error {
+func isUnmanagedField(d AttributeGetter, field string) bool {
+	return d.Get("unmanaged_fields").(*schema.Set).Contains(field)
+}
+
+// suppressUnmanagedFieldDiff returns a DiffSuppressFunc that hides the diff
+// for a field listed in unmanaged_fields, since Terraform won't change it.
+func suppressUnmanagedFieldDiff(field string) schema.SchemaDiffSuppressFunc {
+	return func(_, _, _ string, d *schema.ResourceData) bool {
+		return isUnmanagedField(d, field)
+	}
+}
+
+// appNotificationEmails returns the app's own notification emails, leaving out
+// the provider's default emails unless notification_emails already lists them.
+func appNotificationEmails(allEmails, defaultEmails, emails []string) []string {
+	appEmails := []string{}
+	for _, email := range allEmails {
+		if !ac.SliceContainsString(email, defaultEmails) || ac.SliceContainsString(email, emails) {
+			appEmails = append(appEmails, email)
+		}
+	}
+	return appEmails
+}
+
+func setResourceDataFromApp(d *schema.ResourceData, app ac.App, defaultEmails []string) error {
 	syncPair := app.SyncPair()
 	if err := d.Set("name", app.Name); err != nil {
 		return err
 	}
-	if err := d.Set("rpo", app.RPO/60); err != nil {
+	// Keep the RPO the way it's written in the config when it's unchanged
+	rpo := FormatRPO(app.RPO)
+	if SuppressEquivalentRPO("rpo", d.Get("rpo").(string), rpo, d) {
+		rpo = d.Get("rpo").(string)
+	}
+	if err := d.Set("rpo", rpo); err != nil {
 		return err
 	}
 	if err := d.Set("primary_account_id", syncPair.Source.AccountID); err != nil {
@@ -228,7 +878,11 @@ func setResourceDataFromApp(d *schema.ResourceData, app ac.App) error {
 	if err := d.Set("recovery_region", syncPair.Target.Region); err != nil {
 		return err
 	}
-	if err := d.Set("notification_emails", app.NotificationEmails); err != nil {
+	emails := FromSetToStringList(d.Get("notification_emails"))
+	if err := d.Set("notification_emails", appNotificationEmails(app.NotificationEmails, defaultEmails, emails)); err != nil {
+		return err
+	}
+	if err := d.Set("notification_emails_all", app.NotificationEmails); err != nil {
 		return err
 	}
 	if err := setResourceDataSelectionRulesFromApp(d, app); err != nil {
@@ -237,34 +891,185 @@ func setResourceDataFromApp(d *schema.ResourceData, app ac.App) error {
 	return nil
 }
 
-func setResourceDataSelectionRulesFromApp(d *schema.ResourceData, app ac.App) error {
-	// Combine all the ARN rules into one list, all the tag rules into one map
-	var arns []string
-	tags := map[string]string{}
-
-	for _, rule := range app.SelectionRules {
-		switch rule.GetRuleType() {
-		case ac.ArnRuleType:
-			arnRule := rule.(ac.ArnRule)
-			for _, arn := range arnRule.Arns {
-				arns = append(arns, arn)
-			}
-		case ac.TagRuleType:
-			tagRule := rule.(ac.TagRule)
-			tags[tagRule.Name] = tagRule.Value
-		}
+// recoveryPointLookupRPOs is how many RPOs back to look for the latest
+// recovery point.  A sync pair can have a long history, and recovery points
+// older than this are far outside the RPO anyway.
+const recoveryPointLookupRPOs = 10
+
+// setResourceDataStatusFromApp sets the computed attributes that report how
+// well the app is protected.  Recovery points belong to the app's sync pair,
+// so the recovery point attributes cover every app with the same primary and
+// recovery environments.  The recovery point attributes are only informative,
+// so a failure to look them up is a warning that leaves them empty.
+func setResourceDataStatusFromApp(ctx context.Context, d *schema.ResourceData, client *ac.Client, app ac.App) diag.Diagnostics {
+	if err := d.Set("status", app.SyncPhase); err != nil {
+		return diag.FromErr(err)
+	}
+	createdAt := ""
+	if !app.CreatedAt.IsZero() {
+		createdAt = app.CreatedAt.Format(time.RFC3339)
+	}
+	if err := d.Set("created_at", createdAt); err != nil {
+		return diag.FromErr(err)
 	}
 
-	sort.Strings(arns)
+	now := time.Now()
+	countResources := d.Get("count_protected_resources").(bool)
+	rp, resourceCount, err := findLatestRecoveryPoint(ctx, client, app, now, countResources)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return diag.Errorf("error reading the recovery points of Arpio app %s: %s", app.AppID, ctxErr)
+	}
+	var diags diag.Diagnostics
+	if err != nil {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  fmt.Sprintf("Unable to look up the recovery points of Arpio app %q", app.Name),
+			Detail: fmt.Sprintf("The recovery point attributes are empty until "+
+				"the next refresh: %s", err),
+		})
+		rp, resourceCount = nil, 0
+	}
 
-	if attrs, ok := GetFirstElementAsMap(d.Get("resources")); ok {
-		attrs["arns"] = schema.NewSet(schema.HashString, UntypifyStringList(arns))
-		attrs["tags"] = tags
-		err := d.Set("resources", []interface{}{attrs})
-		if err != nil {
-			return err
-		}
+	rpID := ""
+	lastSyncTime := ""
+	if rp != nil {
+		rpID = rp.RecoveryPointID
+		lastSyncTime = rp.Timestamp.Format(time.RFC3339)
+	}
+	if err := d.Set("latest_recovery_point_id", rpID); err != nil {
+		return append(diags, diag.FromErr(err)...)
+	}
+	if err := d.Set("last_sync_time", lastSyncTime); err != nil {
+		return append(diags, diag.FromErr(err)...)
+	}
+	if err := d.Set("protected_resource_count", resourceCount); err != nil {
+		return append(diags, diag.FromErr(err)...)
+	}
+	if err := d.Set("rpo_compliant", isRPOCompliant(rp, app.RPO, now)); err != nil {
+		return append(diags, diag.FromErr(err)...)
 	}
+	return diags
+}
 
-	return nil
+// findLatestRecoveryPoint finds the latest recovery point of the app's sync
+// pair from the last recoveryPointLookupRPOs RPOs and, if countResources is
+// set, the number of resources in it.  The API has no resource count, so
+// counting lists every resource.  It returns a nil recovery point if there
+// are none, and stops early when ctx is done.
+func findLatestRecoveryPoint(ctx context.Context, client *ac.Client, app ac.App, now time.Time, countResources bool) (*ac.RecoveryPoint, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	timestampMin := recoveryPointLookupMin(app.RPO, now)
+	rp, err := client.FindLatestRecoveryPoint(app.SyncPair(), &timestampMin, nil)
+	if err != nil || rp == nil || !countResources {
+		return rp, 0, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	resources, err := client.ListRecoveryPointResources(app.SyncPair(), *rp)
+	if err != nil {
+		return nil, 0, err
+	}
+	return rp, len(resources), nil
+}
+
+// recoveryPointLookupMin returns the earliest timestamp to look for recovery
+// points at for an RPO of rpoSeconds.  RPOs too long to multiply look back
+// as far as a time.Duration can.
+func recoveryPointLookupMin(rpoSeconds int, now time.Time) time.Time {
+	window := time.Duration(math.MaxInt64)
+	if int64(rpoSeconds) <= math.MaxInt64/int64(recoveryPointLookupRPOs*time.Second) {
+		window = recoveryPointLookupRPOs * time.Duration(rpoSeconds) * time.Second
+	}
+	return now.Add(-window)
+}
+
+// isRPOCompliant returns whether the recovery point is recent enough at the
+// given time to meet an RPO of rpoSeconds.
+func isRPOCompliant(rp *ac.RecoveryPoint, rpoSeconds int, now time.Time) bool {
+	if rp == nil {
+		return false
+	}
+	return now.Sub(rp.Timestamp) <= time.Duration(rpoSeconds)*time.Second
+}
+
+// resourceArpioAppV0 returns the version 0 schema, in which rpo was an integer
+// number of minutes.
+func resourceArpioAppV0() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"rpo": {
+				Type:     schema.TypeInt,
+				Required: true,
+			},
+			"primary_account_id": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"primary_region": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"recovery_account_id": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"recovery_region": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"notification_emails": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"resources": {
+				Type:     schema.TypeSet,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"arns": {
+							Type:     schema.TypeSet,
+							Optional: true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+						"tags": {
+							Type:     schema.TypeMap,
+							Optional: true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// resourceArpioAppStateUpgradeV0 converts rpo from an integer number of
+// minutes to a string, which keeps the same meaning.
+func resourceArpioAppStateUpgradeV0(_ context.Context, rawState map[string]interface{}, _ interface{}) (map[string]interface{}, error) {
+	if rawState == nil {
+		return rawState, nil
+	}
+
+	switch rpo := rawState["rpo"].(type) {
+	case float64:
+		rawState["rpo"] = strconv.Itoa(int(rpo))
+	case int:
+		rawState["rpo"] = strconv.Itoa(rpo)
+	}
+
+	return rawState, nil
 }
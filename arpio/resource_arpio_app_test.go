@@ -1,15 +1,20 @@
 package arpio
 
 import (
+	"context"
 	"fmt"
 	"github.com/arpio/arpio-client-go"
 	"os"
+	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 )
 
@@ -27,6 +32,10 @@ func TestAccArpioAppProtect(t *testing.T) {
 				Config: testAccAppConfig(appName, "60"),
 				Check: resource.ComposeTestCheckFunc(
 					testAccCheckAppAttrs("arpio_app.site", nil, appName, "60"),
+					resource.TestCheckResourceAttrSet("arpio_app.site", "status"),
+					resource.TestCheckResourceAttrSet("arpio_app.site", "created_at"),
+					resource.TestCheckResourceAttrSet("arpio_app.site", "protected_resource_count"),
+					resource.TestCheckResourceAttrSet("arpio_app.site", "rpo_compliant"),
 				),
 			},
 			{
@@ -35,10 +44,65 @@ func TestAccArpioAppProtect(t *testing.T) {
 					testAccCheckAppAttrs("arpio_app.site", nil, appName, "120"),
 				),
 			},
+			{
+				Config: testAccAppConfig(appName, `"90m"`),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckAppAttrs("arpio_app.site", nil, appName, "90m"),
+				),
+			},
+			{
+				// Equivalent RPOs written differently don't cause a diff
+				Config:   testAccAppConfig(appName, `"1h30m"`),
+				PlanOnly: true,
+			},
 		},
 	})
 }
 
+// testAccAppVolatileStatusAttrs are the computed arpio_app attributes that can
+// change between two reads while a test runs.
+var testAccAppVolatileStatusAttrs = append([]string{"status"}, recoveryPointStatusFields...)
+
+func TestIsRPOCompliant(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	rp := func(age time.Duration) *arpio.RecoveryPoint {
+		return &arpio.RecoveryPoint{Timestamp: now.Add(-age)}
+	}
+
+	tests := []struct {
+		rp         *arpio.RecoveryPoint
+		rpoSeconds int
+		want       bool
+	}{
+		{nil, 3600, false},
+		{rp(10 * time.Minute), 3600, true},
+		{rp(time.Hour), 3600, true},
+		{rp(time.Hour + time.Second), 3600, false},
+	}
+	for _, tt := range tests {
+		if got := isRPOCompliant(tt.rp, tt.rpoSeconds, now); got != tt.want {
+			t.Errorf("isRPOCompliant(%v, %d) = %v, want %v", tt.rp, tt.rpoSeconds, got, tt.want)
+		}
+	}
+}
+
+func TestRecoveryPointLookupMin(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	expected := time.Date(2021, 6, 1, 2, 0, 0, 0, time.UTC)
+	if got := recoveryPointLookupMin(3600, now); !got.Equal(expected) {
+		t.Errorf("recoveryPointLookupMin(3600) = %s, want %s", got, expected)
+	}
+
+	// Long RPOs must not overflow into the future
+	rpo, err := ParseRPO("2562047h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := recoveryPointLookupMin(int(rpo/time.Second), now); !got.Before(now) {
+		t.Errorf("recoveryPointLookupMin(%s) = %s, want a time before %s", rpo, got, now)
+	}
+}
+
 func TestAccArpioAppRecover(t *testing.T) {
 	appName := fmt.Sprintf("%s %d", t.Name(), time.Now().UnixNano())
 	defer testAccCleanupApps(appName)
@@ -95,6 +159,948 @@ func TestAccArpioAppRecoverMultipleExist(t *testing.T) {
 	})
 }
 
+func TestResourceArpioAppSyncPairChangeDiff(t *testing.T) {
+	state := &terraform.InstanceState{
+		ID: "app",
+		Attributes: map[string]string{
+			"id":                          "app",
+			"name":                        "site",
+			"rpo":                         "60",
+			"primary_account_id":          "123456789012",
+			"primary_region":              "us-east-1",
+			"recovery_account_id":         "210987654321",
+			"recovery_region":             "us-west-2",
+			"on_existing":                 OnExistingAdopt,
+			"on_destroy":                  OnDestroyDelete,
+			"deletion_protection":         "false",
+			"replace_on_sync_pair_change": "false",
+			"latest_recovery_point_id":    "rp",
+		},
+	}
+	config := func(recoveryRegion string, replace bool) *terraform.ResourceConfig {
+		return terraform.NewResourceConfigRaw(map[string]interface{}{
+			"name":                        "site",
+			"rpo":                         "60",
+			"primary_account_id":          "123456789012",
+			"primary_region":              "us-east-1",
+			"recovery_account_id":         "210987654321",
+			"recovery_region":             recoveryRegion,
+			"replace_on_sync_pair_change": replace,
+		})
+	}
+
+	tests := []struct {
+		recoveryRegion      string
+		replace             bool
+		wantRequiresNew     bool
+		wantRecoveryPointID bool
+	}{
+		{"us-west-2", true, false, true},
+		{"us-west-1", false, false, false},
+		{"us-west-1", true, true, false},
+	}
+	for _, tt := range tests {
+		diff, err := resourceArpioApp().Diff(context.Background(), state, config(tt.recoveryRegion, tt.replace), nil)
+		if err != nil {
+			t.Fatalf("Diff(%s, %t) failed: %s", tt.recoveryRegion, tt.replace, err)
+		}
+		if got := diff.RequiresNew(); got != tt.wantRequiresNew {
+			t.Errorf("Diff(%s, %t) requires new = %t, want %t", tt.recoveryRegion, tt.replace, got, tt.wantRequiresNew)
+		}
+		rpIDDiff := diff.Attributes["latest_recovery_point_id"]
+		if got := rpIDDiff == nil || !rpIDDiff.NewComputed; got != tt.wantRecoveryPointID {
+			t.Errorf("Diff(%s, %t) keeps latest_recovery_point_id = %t, want %t", tt.recoveryRegion, tt.replace, got, tt.wantRecoveryPointID)
+		}
+	}
+
+	abandonConfig := config("us-west-1", true)
+	abandonConfig.Config["on_destroy"] = OnDestroyAbandon
+	abandonConfig.Raw["on_destroy"] = OnDestroyAbandon
+	_, err := resourceArpioApp().Diff(context.Background(), state, abandonConfig, nil)
+	if err == nil || !strings.Contains(err.Error(), "would replace the app") {
+		t.Errorf("Diff with on_destroy = %q should fail: %v", OnDestroyAbandon, err)
+	}
+}
+
+func TestResourceArpioAppCountProtectedResourcesDiff(t *testing.T) {
+	state := &terraform.InstanceState{
+		ID: "app",
+		Attributes: map[string]string{
+			"id":                        "app",
+			"name":                      "site",
+			"rpo":                       "60",
+			"primary_account_id":        "123456789012",
+			"primary_region":            "us-east-1",
+			"recovery_account_id":       "210987654321",
+			"recovery_region":           "us-west-2",
+			"count_protected_resources": "false",
+			"protected_resource_count":  "0",
+		},
+	}
+	config := func(count bool) *terraform.ResourceConfig {
+		return terraform.NewResourceConfigRaw(map[string]interface{}{
+			"name":                      "site",
+			"rpo":                       "60",
+			"primary_account_id":        "123456789012",
+			"primary_region":            "us-east-1",
+			"recovery_account_id":       "210987654321",
+			"recovery_region":           "us-west-2",
+			"count_protected_resources": count,
+		})
+	}
+
+	for _, count := range []bool{false, true} {
+		diff, err := resourceArpioApp().Diff(context.Background(), state, config(count), nil)
+		if err != nil {
+			t.Fatalf("Diff(%t) failed: %s", count, err)
+		}
+		var attr *terraform.ResourceAttrDiff
+		if diff != nil {
+			attr = diff.Attributes["protected_resource_count"]
+		}
+		if got := attr != nil && attr.NewComputed; got != count {
+			t.Errorf("Diff(%t) recomputes protected_resource_count = %t, want %t", count, got, count)
+		}
+	}
+}
+
+func TestResourceArpioAppStateUpgradeV0(t *testing.T) {
+	v0 := map[string]interface{}{
+		"name": "site",
+		"rpo":  float64(60),
+	}
+	expected := map[string]interface{}{
+		"name": "site",
+		"rpo":  "60",
+	}
+
+	actual, err := resourceArpioAppStateUpgradeV0(context.Background(), v0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("%v != %v", actual, expected)
+	}
+}
+
+func TestAccArpioAppOnExisting(t *testing.T) {
+	appName := fmt.Sprintf("%s %d", t.Name(), time.Now().UnixNano())
+	defer testAccCleanupApps(appName)
+
+	var existingAppId StringHolder
+
+	//goland:noinspection ALL
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckArpioAppDestroy,
+		Steps: []resource.TestStep{
+			{
+				PreConfig:   testAccCreateApp(t, appName, "120", &existingAppId),
+				Config:      testAccAppOnExistingConfig(appName, "120", OnExistingError),
+				ExpectError: regexp.MustCompile("already exists; import it"),
+			},
+			{
+				Config:      testAccAppOnExistingConfig(appName, "60", OnExistingAdoptIfMatching),
+				ExpectError: regexp.MustCompile("(?s)already exists with different settings.*rpo: 120 -> 60"),
+			},
+			{
+				Config: testAccAppOnExistingConfig(appName, "120", OnExistingAdoptIfMatching),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrPtr("arpio_app.site", "id", &existingAppId.S),
+				),
+			},
+		},
+	})
+}
+
+func testAccAppOnExistingConfig(appName, rpo, onExisting string) string {
+	return testAccProviderConfig() + testAccAppResourceConfig("site", map[string]string{
+		"name":        strconv.Quote(appName),
+		"rpo":         rpo,
+		"on_existing": strconv.Quote(onExisting),
+	}, "")
+}
+
+func TestAccArpioAppNamePrefix(t *testing.T) {
+	namePrefix := fmt.Sprintf("%s %d-", t.Name(), time.Now().UnixNano())
+	nameRegexp := regexp.MustCompile("^" + regexp.QuoteMeta(namePrefix))
+
+	//goland:noinspection ALL
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckArpioAppDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccAppNamePrefixConfig(namePrefix),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestMatchResourceAttr("arpio_app.a", "name", nameRegexp),
+					resource.TestMatchResourceAttr("arpio_app.b", "name", nameRegexp),
+					func(s *terraform.State) error {
+						a := s.RootModule().Resources["arpio_app.a"].Primary
+						b := s.RootModule().Resources["arpio_app.b"].Primary
+						if a.ID == b.ID || a.Attributes["name"] == b.Attributes["name"] {
+							return fmt.Errorf("apps with the same name_prefix weren't given different names")
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+func testAccAppNamePrefixConfig(namePrefix string) string {
+	args := map[string]string{"name_prefix": strconv.Quote(namePrefix)}
+	return testAccProviderConfig() +
+		testAccAppResourceConfig("a", args, "") +
+		testAccAppResourceConfig("b", args, "")
+}
+
+func TestResourceArpioAppNameValidation(t *testing.T) {
+	tests := []struct {
+		config  map[string]interface{}
+		wantErr bool
+	}{
+		{map[string]interface{}{"name": "site"}, false},
+		{map[string]interface{}{"name_prefix": "site-"}, false},
+		{map[string]interface{}{"name": "site", "name_prefix": "site-"}, true},
+		{map[string]interface{}{}, true},
+	}
+	for _, tt := range tests {
+		config := map[string]interface{}{
+			"rpo":                 "60",
+			"primary_account_id":  "123456789012",
+			"primary_region":      "us-east-1",
+			"recovery_account_id": "210987654321",
+			"recovery_region":     "us-west-2",
+		}
+		for k, v := range tt.config {
+			config[k] = v
+		}
+		diags := resourceArpioApp().Validate(terraform.NewResourceConfigRaw(config))
+		if diags.HasError() != tt.wantErr {
+			t.Errorf("Validate(%v) = %v, want error = %t", tt.config, diags, tt.wantErr)
+		}
+	}
+}
+
+func TestAccArpioAppDeletionProtection(t *testing.T) {
+	appName := fmt.Sprintf("%s %d", t.Name(), time.Now().UnixNano())
+	defer testAccCleanupApps(appName)
+
+	//goland:noinspection ALL
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckArpioAppDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccAppDeletionProtectionConfig(appName, true),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("arpio_app.site", "deletion_protection", "true"),
+				),
+			},
+			{
+				Config:      testAccAppDeletionProtectionConfig(appName, true),
+				Destroy:     true,
+				ExpectError: regexp.MustCompile("has deletion protection"),
+			},
+			{
+				Config: testAccAppDeletionProtectionConfig(appName, false),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("arpio_app.site", "deletion_protection", "false"),
+				),
+			},
+		},
+	})
+}
+
+func testAccAppDeletionProtectionConfig(appName string, deletionProtection bool) string {
+	return testAccProviderConfig() + testAccAppResourceConfig("site", map[string]string{
+		"name":                strconv.Quote(appName),
+		"deletion_protection": strconv.FormatBool(deletionProtection),
+	}, "")
+}
+
+func TestResourceArpioAppDeleteOptions(t *testing.T) {
+	// Neither option reaches the API, so there's no client
+	m := &ProviderMetadata{}
+
+	d := schema.TestResourceDataRaw(t, resourceArpioApp().Schema, map[string]interface{}{
+		"name":                "site",
+		"deletion_protection": true,
+	})
+	d.SetId("app")
+	diags := resourceArpioAppDelete(context.Background(), d, m)
+	if !diags.HasError() || !strings.Contains(diags[0].Summary, "deletion protection") {
+		t.Errorf("expected a deletion protection error, got %v", diags)
+	}
+
+	d = schema.TestResourceDataRaw(t, resourceArpioApp().Schema, map[string]interface{}{
+		"name":       "site",
+		"on_destroy": OnDestroyAbandon,
+	})
+	d.SetId("app")
+	if diags := resourceArpioAppDelete(context.Background(), d, m); diags.HasError() {
+		t.Errorf("expected abandoning the app to succeed, got %v", diags)
+	}
+}
+
+func TestAccArpioAppWaitForFirstRecoveryPoint(t *testing.T) {
+	appName := fmt.Sprintf("%s %d", t.Name(), time.Now().UnixNano())
+	defer testAccCleanupApps(appName)
+
+	//goland:noinspection ALL
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckArpioAppDestroy,
+		Steps: []resource.TestStep{
+			{
+				// A new app can't be synced within the create timeout
+				Config:      testAccAppWaitConfig(appName, "5s"),
+				ExpectError: regexp.MustCompile("error waiting for the first recovery point"),
+			},
+		},
+	})
+}
+
+func testAccAppWaitConfig(appName, createTimeout string) string {
+	return testAccProviderConfig() + testAccAppResourceConfig("site", map[string]string{
+		"name":                          strconv.Quote(appName),
+		"wait_for_first_recovery_point": "true",
+	}, fmt.Sprintf(`
+			timeouts {
+				create = %q
+			}
+			`, createTimeout))
+}
+
+func TestCheckAppUnchangedSinceRead(t *testing.T) {
+	emailKey := strconv.Itoa(schema.HashString("admin@example.com"))
+	d := resourceArpioApp().Data(&terraform.InstanceState{
+		ID: "app",
+		Attributes: map[string]string{
+			"id":                                  "app",
+			"name":                                "site",
+			"rpo":                                 "60",
+			"primary_account_id":                  "123456789012",
+			"primary_region":                      "us-east-1",
+			"recovery_account_id":                 "123456789012",
+			"recovery_region":                     "us-west-2",
+			"notification_emails.#":               "1",
+			"notification_emails." + emailKey:     "admin@example.com",
+			"notification_emails_all.#":           "1",
+			"notification_emails_all." + emailKey: "admin@example.com",
+		},
+	})
+
+	app := arpio.App{
+		AppID:              "app",
+		Name:               "site",
+		RPO:                3600,
+		SourceAwsAccountID: "123456789012",
+		SourceRegion:       "us-east-1",
+		TargetAwsAccountID: "123456789012",
+		TargetRegion:       "us-west-2",
+		NotificationEmails: []string{"admin@example.com"},
+		SelectionRules:     []arpio.SelectionRule{},
+	}
+	if diags := checkAppUnchangedSinceRead(d, app); diags.HasError() {
+		t.Fatalf("unexpected conflict: %v", diags)
+	}
+
+	app.RPO = 900
+	app.NotificationEmails = []string{"admin@example.com", "other@example.com"}
+	diags := checkAppUnchangedSinceRead(d, app)
+	if !diags.HasError() {
+		t.Fatalf("expected a conflict")
+	}
+	if !strings.Contains(diags[0].Detail, "rpo: 60 -> 15") ||
+		!strings.Contains(diags[0].Detail, "notification_emails:") {
+		t.Fatalf("conflict doesn't describe the changes: %s", diags[0].Detail)
+	}
+}
+
+func TestAccArpioAppDefaultNotificationEmails(t *testing.T) {
+	appName := fmt.Sprintf("%s %d", t.Name(), time.Now().UnixNano())
+	defer testAccCleanupApps(appName)
+
+	//goland:noinspection ALL
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckArpioAppDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccAppDefaultNotificationEmailsConfig(appName,
+					`["oncall@example.com"]`, `["admin@example.com", "oncall@example.com"]`),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("arpio_app.site", "notification_emails.#", "2"),
+					resource.TestCheckResourceAttr("arpio_app.site", "notification_emails_all.#", "2"),
+				),
+			},
+			{
+				Config: testAccAppDefaultNotificationEmailsConfig(appName,
+					`["oncall@example.com", "ops@example.com"]`, `["admin@example.com"]`),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("arpio_app.site", "notification_emails.#", "1"),
+					resource.TestCheckTypeSetElemAttr("arpio_app.site", "notification_emails.*", "admin@example.com"),
+					resource.TestCheckResourceAttr("arpio_app.site", "notification_emails_all.#", "3"),
+					resource.TestCheckTypeSetElemAttr("arpio_app.site", "notification_emails_all.*", "ops@example.com"),
+				),
+			},
+			{
+				Config: testAccAppDefaultNotificationEmailsConfig(appName,
+					`["oncall@example.com", "ops@example.com"]`, `["admin@example.com"]`),
+				PlanOnly: true,
+			},
+		},
+	})
+}
+
+func testAccAppDefaultNotificationEmailsConfig(appName, defaultEmails, emails string) string {
+	return testAccProviderConfigWith("default_notification_emails = "+defaultEmails) +
+		testAccAppResourceConfig("site", map[string]string{
+			"name":                strconv.Quote(appName),
+			"notification_emails": emails,
+		}, "")
+}
+
+func TestResourceArpioAppNotificationEmailsDiff(t *testing.T) {
+	config := terraform.NewResourceConfigRaw(map[string]interface{}{
+		"name":                "site",
+		"rpo":                 "60",
+		"primary_account_id":  "123456789012",
+		"primary_region":      "us-east-1",
+		"recovery_account_id": "210987654321",
+		"recovery_region":     "us-west-2",
+		"notification_emails": []interface{}{"admin@example.com", "ops@example.com"},
+	})
+	m := &ProviderMetadata{DefaultNotificationEmails: []string{"ops@example.com", "oncall@example.com"}}
+
+	diff, err := resourceArpioApp().Diff(context.Background(), nil, config, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var planned []string
+	for k, attr := range diff.Attributes {
+		if strings.HasPrefix(k, "notification_emails_all.") && k != "notification_emails_all.#" {
+			planned = append(planned, attr.New)
+		}
+	}
+	sort.Strings(planned)
+	expected := []string{"admin@example.com", "oncall@example.com", "ops@example.com"}
+	if !reflect.DeepEqual(planned, expected) {
+		t.Fatalf("planned notification_emails_all %v != %v", planned, expected)
+	}
+}
+
+// testUnknownValue is how Terraform represents an unknown value in a raw
+// resource config.
+const testUnknownValue = "74D93920-ED26-11E3-AC10-0800200C9A66"
+
+func TestResourceArpioAppNotificationEmailsDiffUnknown(t *testing.T) {
+	config := terraform.NewResourceConfigRaw(map[string]interface{}{
+		"name":                "site",
+		"rpo":                 "60",
+		"primary_account_id":  "123456789012",
+		"primary_region":      "us-east-1",
+		"recovery_account_id": "210987654321",
+		"recovery_region":     "us-west-2",
+		"notification_emails": []interface{}{"admin@example.com", testUnknownValue},
+	})
+	m := &ProviderMetadata{DefaultNotificationEmails: []string{"ops@example.com"}}
+
+	diff, err := resourceArpioApp().Diff(context.Background(), nil, config, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attr := diff.Attributes["notification_emails_all.#"]
+	if attr == nil || !attr.NewComputed {
+		t.Fatalf("notification_emails_all should be unknown: %v", attr)
+	}
+}
+
+func TestSetAppFromResourceDataNotificationEmailsUnknown(t *testing.T) {
+	config := terraform.NewResourceConfigRaw(map[string]interface{}{
+		"name":                "site",
+		"rpo":                 "60",
+		"primary_account_id":  "123456789012",
+		"primary_region":      "us-east-1",
+		"recovery_account_id": "210987654321",
+		"recovery_region":     "us-west-2",
+		"notification_emails": []interface{}{"admin@example.com"},
+	})
+	diff, err := resourceArpioApp().Diff(context.Background(), nil, config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Once notification_emails is known at apply, the apply-time diff still
+	// has notification_emails_all as unknown, since CustomizeDiff doesn't run
+	for k := range diff.Attributes {
+		if strings.HasPrefix(k, "notification_emails_all.") {
+			delete(diff.Attributes, k)
+		}
+	}
+	diff.Attributes["notification_emails_all.#"] = &terraform.ResourceAttrDiff{NewComputed: true}
+	d, err := schema.InternalMap(resourceArpioApp().Schema).Data(nil, diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var app arpio.App
+	if err := setAppFromResourceData(d, &app, []string{"ops@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"admin@example.com", "ops@example.com"}
+	if !reflect.DeepEqual(app.NotificationEmails, expected) {
+		t.Fatalf("%v != %v", app.NotificationEmails, expected)
+	}
+}
+
+func TestAppNotificationEmails(t *testing.T) {
+	all := []string{"admin@example.com", "oncall@example.com", "ops@example.com"}
+	defaults := []string{"oncall@example.com", "ops@example.com"}
+
+	// Defaults are left out unless the app lists them itself
+	emails := appNotificationEmails(all, defaults, []string{"ops@example.com"})
+	expected := []string{"admin@example.com", "ops@example.com"}
+	if !reflect.DeepEqual(emails, expected) {
+		t.Fatalf("%v != %v", emails, expected)
+	}
+}
+
+func TestSetAppFromResourceDataUnmanagedFields(t *testing.T) {
+	raw := map[string]interface{}{
+		"name":                "site",
+		"rpo":                 "60",
+		"primary_account_id":  "123456789012",
+		"primary_region":      "us-east-1",
+		"recovery_account_id": "123456789012",
+		"recovery_region":     "us-west-2",
+		"unmanaged_fields":    []interface{}{"notification_emails", "resources"},
+	}
+	d := schema.TestResourceDataRaw(t, resourceArpioApp().Schema, raw)
+
+	app := arpio.App{
+		RPO:                900,
+		NotificationEmails: []string{"admin@example.com"},
+		SelectionRules:     []arpio.SelectionRule{arpio.NewTagRule("Team", "a")},
+	}
+	if err := setAppFromResourceData(d, &app, []string{"ops@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if app.RPO != 3600 {
+		t.Fatalf("managed rpo was not set")
+	}
+	if len(app.NotificationEmails) != 1 || len(app.SelectionRules) != 1 {
+		t.Fatalf("unmanaged fields were changed: %v", app)
+	}
+}
+
+func TestAccArpioAppUnmanagedFields(t *testing.T) {
+	appName := fmt.Sprintf("%s %d", t.Name(), time.Now().UnixNano())
+	defer testAccCleanupApps(appName)
+
+	//goland:noinspection ALL
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckArpioAppDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccAppConfig(appName, "60"),
+			},
+			{
+				// Unmanaged fields that aren't in the config are left alone
+				Config: testAccAppResourcesConfig(appName, `
+					unmanaged_fields = ["notification_emails", "resources"]
+					`),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("arpio_app.site", "notification_emails.#", "2"),
+					resource.TestCheckResourceAttr("arpio_app.site", "resources.#", "1"),
+				),
+			},
+			{
+				// Managed fields that aren't in the config are cleared
+				Config: testAccAppResourcesConfig(appName, ""),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("arpio_app.site", "notification_emails.#", "0"),
+					resource.TestCheckResourceAttr("arpio_app.site", "resources.#", "0"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccArpioAppImport(t *testing.T) {
+	appName := fmt.Sprintf("%s %d", t.Name(), time.Now().UnixNano())
+	defer testAccCleanupApps(appName)
+
+	//goland:noinspection ALL
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckArpioAppDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccAppConfig(appName, "60"),
+			},
+			{
+				// Import by app ID
+				ResourceName:            "arpio_app.site",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: testAccAppVolatileStatusAttrs,
+			},
+			{
+				// Import by app name
+				ResourceName:            "arpio_app.site",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: testAccAppVolatileStatusAttrs,
+				ImportStateId:           appImportNamePrefix + appName,
+			},
+			{
+				ResourceName:  "arpio_app.site",
+				ImportState:   true,
+				ImportStateId: appImportNamePrefix + appName + " missing",
+				ExpectError:   regexp.MustCompile("there is no Arpio app named"),
+			},
+		},
+	})
+}
+
+func TestAccArpioAppImportMultipleExist(t *testing.T) {
+	appName := fmt.Sprintf("%s %d", t.Name(), time.Now().UnixNano())
+	defer testAccCleanupApps(appName)
+
+	//goland:noinspection ALL
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckArpioAppDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccAppConfig(appName, "60"),
+			},
+			{
+				// Importing by a name that more than one app shares fails
+				PreConfig:     testAccCreateApp(t, appName, "120", nil),
+				ResourceName:  "arpio_app.site",
+				ImportState:   true,
+				ImportStateId: appImportNamePrefix + appName,
+				ExpectError:   regexp.MustCompile("more than one Arpio app exists with the name"),
+			},
+		},
+	})
+}
+
+func TestAccArpioAppMultipleResources(t *testing.T) {
+	appName := fmt.Sprintf("%s %d", t.Name(), time.Now().UnixNano())
+	defer testAccCleanupApps(appName)
+
+	//goland:noinspection ALL
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckArpioAppDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccAppResourcesConfig(appName, `
+					resources {
+						arns = ["arn:aws:ec2:%[1]s:%[2]s:instance/i-abcdefg1234567890"]
+						tags = {
+							"Team" = "a"
+						}
+					}
+					resources {
+						arns = ["arn:aws:ec2:%[1]s:%[2]s:instance/i-bcdefgh1234567890"]
+						tags = {
+							"Team" = "b"
+						}
+					}
+					resources {
+						tags = {
+							"Service" = "c"
+						}
+					}
+					`),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("arpio_app.site", "resources.#", "3"),
+				),
+			},
+			{
+				// Import can't tell which block each rule came from, so the
+				// tag rules are grouped with the first ARN rule
+				ResourceName:     "arpio_app.site",
+				ImportState:      true,
+				ImportStateCheck: testAccCheckImportedMultipleResources,
+			},
+			{
+				Config: testAccAppResourcesConfig(appName, `
+					resources {
+						tags = {
+							"Team" = "a"
+						}
+					}
+					resources {
+						tags = {
+							"Team" = "a"
+						}
+						arns = ["arn:aws:ec2:%[1]s:%[2]s:instance/i-abcdefg1234567890"]
+					}
+					`),
+				ExpectError: regexp.MustCompile("appears in more than one tags or tag_rule entry"),
+			},
+			{
+				Config:      testAccAppResourcesConfig(appName, `resources {}`),
+				ExpectError: regexp.MustCompile("must specify at least one ARN, CloudFormation stack, tag or tag_rule"),
+			},
+		},
+	})
+}
+
+// testAccCheckImportedMultipleResources checks the resources blocks that
+// TestAccArpioAppMultipleResources imports: one block with an ARN, a Team
+// tag_rule with two values and the Service tag, and one with the other ARN.
+func testAccCheckImportedMultipleResources(states []*terraform.InstanceState) error {
+	if len(states) != 1 {
+		return fmt.Errorf("expected 1 imported app, got %d", len(states))
+	}
+	attrs := states[0].Attributes
+	if attrs["resources.#"] != "2" {
+		return fmt.Errorf("expected 2 resources blocks, got %s", attrs["resources.#"])
+	}
+
+	counts := map[string]int{}
+	for k, v := range attrs {
+		parts := strings.Split(k, ".")
+		if len(parts) < 3 || parts[0] != "resources" {
+			continue
+		}
+		attr := strings.Join(parts[2:], ".")
+		switch {
+		case attr == "arns.#" && v == "1":
+			counts["arns"]++
+		case attr == "tags.Service" && v == "c":
+			counts["service tag"]++
+		case len(parts) == 6 && parts[2] == "tag_rule" && parts[4] == "values" && parts[5] == "#" && v == "2":
+			counts["team tag_rule"]++
+		}
+	}
+	expected := map[string]int{"arns": 2, "service tag": 1, "team tag_rule": 1}
+	if !reflect.DeepEqual(counts, expected) {
+		return fmt.Errorf("expected resources blocks %v, got %v", expected, counts)
+	}
+	return nil
+}
+
+func TestAccArpioAppTagRules(t *testing.T) {
+	appName := fmt.Sprintf("%s %d", t.Name(), time.Now().UnixNano())
+	defer testAccCleanupApps(appName)
+
+	//goland:noinspection ALL
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckArpioAppDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccAppResourcesConfig(appName, `
+					resources {
+						tag_rule {
+							key    = "Team"
+							values = ["a", "b", "c"]
+						}
+						tag_rule {
+							key    = "ArpioProtectThis"
+							exists = true
+						}
+					}
+					`),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("arpio_app.site", "resources.#", "1"),
+					resource.TestCheckResourceAttr("arpio_app.site", "resources.0.tag_rule.#", "2"),
+				),
+			},
+			{
+				Config: testAccAppResourcesConfig(appName, `
+					resources {
+						tag_rule {
+							key    = "Team"
+							values = ["a"]
+							exists = true
+						}
+					}
+					`),
+				ExpectError: regexp.MustCompile("specify either values or exists, not both"),
+			},
+		},
+	})
+}
+
+func TestAccArpioAppCloudFormationStacks(t *testing.T) {
+	appName := fmt.Sprintf("%s %d", t.Name(), time.Now().UnixNano())
+	defer testAccCleanupApps(appName)
+
+	//goland:noinspection ALL
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckArpioAppDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccAppResourcesConfig(appName, `
+					resources {
+						cloudformation_stacks = [
+							"arn:aws:cloudformation:%[1]s:%[2]s:stack/site/0f3e2a50-1c1e-11ec-9621-0242ac130002",
+						]
+					}
+					`),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("arpio_app.site", "resources.0.cloudformation_stacks.#", "1"),
+				),
+			},
+			{
+				ResourceName:            "arpio_app.site",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: testAccAppVolatileStatusAttrs,
+			},
+			{
+				Config: testAccAppResourcesConfig(appName, `
+					resources {
+						cloudformation_stacks = ["arn:aws:s3:::bucket"]
+					}
+					`),
+				ExpectError: regexp.MustCompile("is not a CloudFormation stack ARN"),
+			},
+		},
+	})
+}
+
+func TestAccArpioAppArnValidation(t *testing.T) {
+	appName := fmt.Sprintf("%s %d", t.Name(), time.Now().UnixNano())
+	defer testAccCleanupApps(appName)
+
+	//goland:noinspection ALL
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckArpioAppDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccAppResourcesConfig(appName, `
+					resources {
+						arns = ["arn:aws:dynamodb:us-east1:%[2]s:table/app"]
+					}
+					`),
+				ExpectError: regexp.MustCompile("has an invalid region"),
+			},
+			{
+				Config: testAccAppResourcesConfig(appName, `
+					resources {
+						arns = ["arn:aws:dynamodb:%[1]s:000000000000:table/app"]
+					}
+					`),
+				ExpectError: regexp.MustCompile("Arpio only protects resources in the primary account"),
+			},
+		},
+	})
+}
+
+func TestAccArpioAppSyncPairValidation(t *testing.T) {
+	appName := fmt.Sprintf("%s %d", t.Name(), time.Now().UnixNano())
+	defer testAccCleanupApps(appName)
+
+	//goland:noinspection ALL
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckArpioAppDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config:      testAccAppSyncPairConfig(appName, "12345678901", "us-east-1", "123456789012", "us-west-2"),
+				ExpectError: regexp.MustCompile("is an invalid AWS account ID"),
+			},
+			{
+				Config:      testAccAppSyncPairConfig(appName, "123456789012", "us-east1", "123456789012", "us-west-2"),
+				ExpectError: regexp.MustCompile("is not a known AWS region"),
+			},
+			{
+				Config:      testAccAppSyncPairConfig(appName, "123456789012", "us-east-1", "123456789012", "cn-north-1"),
+				ExpectError: regexp.MustCompile("Arpio can only recover within a partition"),
+			},
+			{
+				Config:      testAccAppSyncPairConfig(appName, "123456789012", "us-east-1", "123456789012", "us-east-1"),
+				ExpectError: regexp.MustCompile("must differ from the primary environment"),
+			},
+		},
+	})
+}
+
+func testAccAppSyncPairConfig(appName, primaryAccountID, primaryRegion, recoveryAccountID, recoveryRegion string) string {
+	return testAccProviderConfig() + testAccAppResourceConfig("site", map[string]string{
+		"name":                strconv.Quote(appName),
+		"primary_account_id":  strconv.Quote(primaryAccountID),
+		"primary_region":      strconv.Quote(primaryRegion),
+		"recovery_account_id": strconv.Quote(recoveryAccountID),
+		"recovery_region":     strconv.Quote(recoveryRegion),
+	}, "")
+}
+
+// testAccAppResourcesConfig returns an app config with the specified
+// resources blocks.
+func testAccAppResourcesConfig(appName, resourcesBlocks string) string {
+	return testAccProviderConfig() + testAccAppResourceConfig("site", map[string]string{
+		"name": strconv.Quote(appName),
+	}, resourcesBlocks)
+}
+
+// testAccAppResourceConfig returns an arpio_app resource.  args maps argument
+// names to HCL expressions.  The RPO defaults to 60 minutes, and the primary
+// and recovery environments default to the test ones.  blocks holds nested
+// blocks, which may refer to the primary region and account ID as %[1]s and
+// %[2]s.  These are replaced as plain text, so blocks that don't use them are
+// left unchanged.
+func testAccAppResourceConfig(resourceName string, args map[string]string, blocks string) string {
+	sourceAwsAccountID := os.Getenv(ArpioTestSourceAwsAccountIDEnv)
+	sourceRegion := os.Getenv(ArpioTestSourceApiRegionEnv)
+
+	allArgs := map[string]string{
+		"rpo":                 "60",
+		"primary_account_id":  strconv.Quote(sourceAwsAccountID),
+		"primary_region":      strconv.Quote(sourceRegion),
+		"recovery_account_id": strconv.Quote(os.Getenv(ArpioTestTargetAwsAccountIDEnv)),
+		"recovery_region":     strconv.Quote(os.Getenv(ArpioTestTargetApiRegionEnv)),
+	}
+	for k, v := range args {
+		allArgs[k] = v
+	}
+
+	var lines []string
+	for _, k := range SortedStringMapKeys(allArgs) {
+		lines = append(lines, fmt.Sprintf("\t\t\t%s = %s", k, allArgs[k]))
+	}
+
+	return fmt.Sprintf(`
+		resource "arpio_app" %q {
+%s
+			%s
+		}
+		`,
+		resourceName,
+		strings.Join(lines, "\n"),
+		strings.NewReplacer("%[1]s", sourceRegion, "%[2]s", sourceAwsAccountID).Replace(blocks),
+	)
+}
+
 func testAccAppConfig(appName, rpo string) string {
 	accountID := os.Getenv(ArpioAccountIDEnv)
 	apiKeyID := os.Getenv(ArpioApiKeyIDEnv)
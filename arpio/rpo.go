@@ -0,0 +1,72 @@
+package arpio
+
+import (
+	"fmt"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"math"
+	"strconv"
+	"time"
+)
+
+// ParseRPO parses an RPO written as an integer number of minutes (the
+// original format of the rpo attribute) or as a duration like "15m" or "1h".
+func ParseRPO(s string) (time.Duration, error) {
+	if minutes, err := strconv.ParseInt(s, 10, 64); err == nil {
+		// Check the range first so the conversion can't overflow
+		if minutes > math.MaxInt64/int64(time.Minute) || minutes < math.MinInt64/int64(time.Minute) {
+			return 0, fmt.Errorf("%q minutes is out of range", s)
+		}
+		return time.Duration(minutes) * time.Minute, nil
+	}
+
+	rpo, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number of minutes or a duration "+
+			"like \"15m\" or \"1h\"", s)
+	}
+	return rpo, nil
+}
+
+// FormatRPO formats an RPO in seconds, as the Arpio API stores it.  Whole
+// minutes are formatted as a number of minutes for compatibility with
+// existing configurations.
+func FormatRPO(seconds int) string {
+	if seconds%60 == 0 {
+		return strconv.Itoa(seconds / 60)
+	}
+	return (time.Duration(seconds) * time.Second).String()
+}
+
+func ValidateRPO(v interface{}, k string) (ws []string, errors []error) {
+	value := v.(string)
+
+	rpo, err := ParseRPO(value)
+	if err != nil {
+		errors = append(errors, fmt.Errorf("%q: %s", k, err))
+		return ws, errors
+	}
+	if rpo%time.Second != 0 {
+		errors = append(errors, fmt.Errorf("%q (%s) must be a whole number of seconds", k, value))
+		return ws, errors
+	}
+	if rpo <= 0 {
+		errors = append(errors, fmt.Errorf("%q (%s) must be positive", k, value))
+		return ws, errors
+	}
+
+	return ws, errors
+}
+
+// SuppressEquivalentRPO suppresses diffs between RPOs written differently,
+// like "60" and "1h".
+func SuppressEquivalentRPO(_, old, new string, _ *schema.ResourceData) bool {
+	oldRPO, err := ParseRPO(old)
+	if err != nil {
+		return false
+	}
+	newRPO, err := ParseRPO(new)
+	if err != nil {
+		return false
+	}
+	return oldRPO == newRPO
+}
@@ -0,0 +1,65 @@
+package arpio
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRPO(t *testing.T) {
+	cases := map[string]time.Duration{
+		"60":    time.Hour,
+		"15m":   15 * time.Minute,
+		"1h30m": 90 * time.Minute,
+		"90s":   90 * time.Second,
+	}
+	for s, expected := range cases {
+		rpo, err := ParseRPO(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rpo != expected {
+			t.Errorf("ParseRPO(%q) = %s, expected %s", s, rpo, expected)
+		}
+	}
+
+	for _, s := range []string{"1 hour", "9007199254741052", "-9007199254741052"} {
+		if _, err := ParseRPO(s); err == nil {
+			t.Errorf("ParseRPO(%q) should fail", s)
+		}
+	}
+}
+
+func TestFormatRPO(t *testing.T) {
+	cases := map[int]string{
+		3600: "60",
+		60:   "1",
+		90:   "1m30s",
+	}
+	for seconds, expected := range cases {
+		if s := FormatRPO(seconds); s != expected {
+			t.Errorf("FormatRPO(%d) = %q, expected %q", seconds, s, expected)
+		}
+	}
+}
+
+func TestValidateRPO(t *testing.T) {
+	cases := map[string]bool{
+		"60":               true,
+		"15m":              true,
+		"90s":              true,
+		"168h":             true,
+		"30s":              true,
+		"20160":            true,
+		"0":                false,
+		"-5m":              false,
+		"1m500ms":          false,
+		"9007199254741052": false,
+		"soon":             false,
+	}
+	for s, valid := range cases {
+		_, errs := ValidateRPO(s, "rpo")
+		if (len(errs) == 0) != valid {
+			t.Errorf("ValidateRPO(%q) valid should be %t: %v", s, valid, errs)
+		}
+	}
+}
@@ -2,9 +2,28 @@ package arpio
 
 import (
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"sort"
+	"strings"
 	"time"
 )
 
+// AttributeGetter reads attribute values.  *schema.ResourceData and
+// PriorState implement it.
+type AttributeGetter interface {
+	Get(key string) interface{}
+}
+
+// PriorState reads the values a resource had in its state before the
+// change being applied.
+type PriorState struct {
+	D *schema.ResourceData
+}
+
+func (s PriorState) Get(key string) interface{} {
+	old, _ := s.D.GetChange(key)
+	return old
+}
+
 func GetFirstElementAsMap(s interface{}) (m map[string]interface{}, ok bool) {
 	var slice []interface{}
 
@@ -28,6 +47,22 @@ func GetFirstElementAsMap(s interface{}) (m map[string]interface{}, ok bool) {
 	return slice[0].(map[string]interface{}), true
 }
 
+// SetValueKnown reports whether the new value of a set attribute, including
+// every element, is known at plan time.  NewValueKnown alone reports a set
+// with unknown elements as known: the unknown elements are left out of its
+// value, and their set codes start with "~" in the diff.
+func SetValueKnown(d *schema.ResourceDiff, key string) bool {
+	if !d.NewValueKnown(key) || !d.NewValueKnown(key+".#") {
+		return false
+	}
+	for _, k := range d.GetChangedKeysPrefix(key + ".") {
+		if strings.Contains(k, ".~") {
+			return false
+		}
+	}
+	return true
+}
+
 func FromSetToStringList(v interface{}) []string {
 	if v != nil {
 		return TypifyStringList(v.(*schema.Set).List())
@@ -74,6 +109,36 @@ func UntypifyStringMap(values map[string]string) map[string]interface{} {
 	return m
 }
 
+func SortedStringMapKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func SortedIntMapKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func StringListsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func ParseRFC3339Timestamp(ts string) (*time.Time, error) {
 	if ts == "" {
 		return nil, nil
@@ -0,0 +1,353 @@
+package arpio
+
+import (
+	"errors"
+	"fmt"
+	ac "github.com/arpio/arpio-client-go"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"sort"
+)
+
+// errEmptyResourcesBlock reports a resources block with nothing to match.
+var errEmptyResourcesBlock = errors.New("each resources block must specify " +
+	"at least one ARN, CloudFormation stack, tag or tag_rule")
+
+func setAppSelectionRulesFromResourceData(d AttributeGetter, app *ac.App) error {
+	var rules []ac.SelectionRule
+
+	blocks := d.Get("resources").(*schema.Set).List()
+	if err := checkResourcesBlocks(blocks); err != nil {
+		return err
+	}
+
+	accountID := d.Get("primary_account_id").(string)
+	region := d.Get("primary_region").(string)
+
+	for _, block := range blocks {
+		attrs := block.(map[string]interface{})
+		arns := FromSetToStringList(attrs["arns"])
+
+		// Include one ARN rule that covers all the block's ARNs
+		if len(arns) > 0 {
+			for _, a := range arns {
+				arn, err := ParseARN(a)
+				if err != nil {
+					return err
+				}
+				if err := validateArnInPrimary(arn, accountID, region); err != nil {
+					return err
+				}
+			}
+			sort.Strings(arns)
+			rules = append(rules, ac.NewArnRule(arns))
+		}
+
+		for _, stack := range FromSetToStringList(attrs["cloudformation_stacks"]) {
+			arn, err := ParseARN(stack)
+			if err != nil {
+				return err
+			}
+			if err := validateArnInPrimary(arn, accountID, region); err != nil {
+				return err
+			}
+		}
+
+		tagRules, err := expandResourcesBlockTagRules(attrs)
+		if err != nil {
+			return err
+		}
+		for _, rule := range tagRules {
+			rules = append(rules, rule)
+		}
+	}
+
+	app.SelectionRules = rules
+	return nil
+}
+
+// checkResourcesBlocks checks for resources blocks that can't be represented
+// as selection rules: empty blocks, and tags that appear in more than one
+// entry.  Tag rules don't record which block they came from, so the same tag
+// in two blocks could not be read back into the right places.
+func checkResourcesBlocks(blocks []interface{}) error {
+	seenTags := map[ac.TagRule]bool{}
+
+	for _, block := range blocks {
+		attrs := block.(map[string]interface{})
+		if len(FromSetToStringList(attrs["arns"])) == 0 &&
+			len(FromSetToStringList(attrs["cloudformation_stacks"])) == 0 &&
+			len(FromSetToStringMap(attrs["tags"])) == 0 &&
+			attrs["tag_rule"].(*schema.Set).Len() == 0 {
+			return errEmptyResourcesBlock
+		}
+
+		tagRules, err := expandResourcesBlockTagRules(attrs)
+		if err != nil {
+			return err
+		}
+		for _, rule := range tagRules {
+			if seenTags[rule] {
+				return fmt.Errorf("the tag %s=%q appears in more than one "+
+					"tags or tag_rule entry; specify it only once",
+					rule.Name, rule.Value)
+			}
+			seenTags[rule] = true
+		}
+	}
+	return nil
+}
+
+// expandResourcesBlockTagRules returns the tag rules of a resources block:
+// one for each CloudFormation stack, tag, and tag_rule value.
+func expandResourcesBlockTagRules(attrs map[string]interface{}) ([]ac.TagRule, error) {
+	var tagRules []ac.TagRule
+
+	// CloudFormation tags the resources it creates with the stack's ARN,
+	// so include one tag rule for each stack
+	stacks := FromSetToStringList(attrs["cloudformation_stacks"])
+	sort.Strings(stacks)
+	for _, stack := range stacks {
+		arn, err := ParseARN(stack)
+		if err != nil {
+			return nil, err
+		}
+		if !arn.IsCloudFormationStack() {
+			return nil, fmt.Errorf("%q is not a valid CloudFormation stack ARN", stack)
+		}
+		tagRules = append(tagRules, ac.NewTagRule(CloudFormationStackIDTag, stack))
+	}
+
+	// Include one tag rule for each key and value
+	tags := FromSetToStringMap(attrs["tags"])
+	for _, k := range SortedStringMapKeys(tags) {
+		tagRules = append(tagRules, ac.NewTagRule(k, tags[k]))
+	}
+	for _, tagRuleBlock := range attrs["tag_rule"].(*schema.Set).List() {
+		k, values, err := expandTagRule(tagRuleBlock.(map[string]interface{}))
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range values {
+			tagRules = append(tagRules, ac.NewTagRule(k, v))
+		}
+	}
+	return tagRules, nil
+}
+
+// validateArnInPrimary checks that an ARN is in the app's primary account and
+// region, which is where Arpio looks for resources to protect.  ARNs without
+// an account or region, like those of S3 buckets, can be in any account or
+// region.
+func validateArnInPrimary(arn ARN, accountID, region string) error {
+	if arn.AccountID != "" && arn.AccountID != accountID {
+		return fmt.Errorf("%s is in AWS account %s, but primary_account_id "+
+			"is %s; Arpio only protects resources in the primary account",
+			arn, arn.AccountID, accountID)
+	}
+	if arn.Region != "" && arn.Region != region {
+		return fmt.Errorf("%s is in region %s, but primary_region is %s; "+
+			"Arpio only protects resources in the primary region",
+			arn, arn.Region, region)
+	}
+	return nil
+}
+
+// expandTagRule returns the key and values of a tag_rule block.  A rule that
+// matches any value for the key has the single value "", which is how the
+// Arpio API represents it.
+func expandTagRule(attrs map[string]interface{}) (key string, values []string, err error) {
+	key = attrs["key"].(string)
+	values = FromSetToStringList(attrs["values"])
+	exists := attrs["exists"].(bool)
+
+	if exists && len(values) > 0 {
+		return key, nil, fmt.Errorf("tag_rule %q: specify either values "+
+			"or exists, not both", key)
+	}
+	if exists {
+		return key, []string{""}, nil
+	}
+	if len(values) == 0 {
+		return key, nil, fmt.Errorf("tag_rule %q: specify values or set "+
+			"exists = true", key)
+	}
+
+	sort.Strings(values)
+	return key, values, nil
+}
+
+func setResourceDataSelectionRulesFromApp(d *schema.ResourceData, app ac.App) error {
+	var arnRules [][]string
+	var tagRules []ac.TagRule
+
+	for _, rule := range app.SelectionRules {
+		switch rule.GetRuleType() {
+		case ac.ArnRuleType:
+			arnRule := rule.(ac.ArnRule)
+			arns := append([]string{}, arnRule.Arns...)
+			sort.Strings(arns)
+			arnRules = append(arnRules, arns)
+		case ac.TagRuleType:
+			tagRules = append(tagRules, rule.(ac.TagRule))
+		}
+	}
+
+	// claimTagRule removes a matching tag rule from the ones left to place
+	claimTagRule := func(k, v string) bool {
+		for i, tagRule := range tagRules {
+			if tagRule.Name == k && tagRule.Value == v {
+				tagRules = append(tagRules[:i], tagRules[i+1:]...)
+				return true
+			}
+		}
+		return false
+	}
+
+	var blocks []interface{}
+
+	// The app's rules don't say which block they came from, so give each
+	// block already in the state the rules that match it.  This keeps the
+	// blocks stable across reads.
+	for _, block := range d.Get("resources").(*schema.Set).List() {
+		attrs := block.(map[string]interface{})
+
+		var arns []string
+		wantArns := FromSetToStringList(attrs["arns"])
+		sort.Strings(wantArns)
+		if len(wantArns) > 0 {
+			for i, haveArns := range arnRules {
+				if StringListsEqual(wantArns, haveArns) {
+					arns = haveArns
+					arnRules = append(arnRules[:i], arnRules[i+1:]...)
+					break
+				}
+			}
+		}
+
+		var stacks []string
+		for _, stack := range FromSetToStringList(attrs["cloudformation_stacks"]) {
+			if claimTagRule(CloudFormationStackIDTag, stack) {
+				stacks = append(stacks, stack)
+			}
+		}
+
+		tags := map[string]string{}
+		for k, v := range FromSetToStringMap(attrs["tags"]) {
+			if claimTagRule(k, v) {
+				tags[k] = v
+			}
+		}
+
+		var tagRuleBlocks []interface{}
+		for _, tagRuleBlock := range attrs["tag_rule"].(*schema.Set).List() {
+			tagRuleAttrs := tagRuleBlock.(map[string]interface{})
+			k := tagRuleAttrs["key"].(string)
+			if tagRuleAttrs["exists"].(bool) {
+				if claimTagRule(k, "") {
+					tagRuleBlocks = append(tagRuleBlocks, newTagRuleBlock(k, nil, true))
+				}
+				continue
+			}
+
+			var values []string
+			for _, v := range FromSetToStringList(tagRuleAttrs["values"]) {
+				if claimTagRule(k, v) {
+					values = append(values, v)
+				}
+			}
+			if len(values) > 0 {
+				tagRuleBlocks = append(tagRuleBlocks, newTagRuleBlock(k, values, false))
+			}
+		}
+
+		if len(arns) > 0 || len(stacks) > 0 || len(tags) > 0 || len(tagRuleBlocks) > 0 {
+			blocks = append(blocks, newResourcesBlock(arns, stacks, tags, tagRuleBlocks))
+		}
+	}
+
+	// Put the remaining rules (e.g. after an import, or rules added outside
+	// Terraform) in new blocks: one per ARN rule, with all the tag rules in
+	// the first one.
+	if len(arnRules) > 0 || len(tagRules) > 0 {
+		var arns []string
+		if len(arnRules) > 0 {
+			arns, arnRules = arnRules[0], arnRules[1:]
+		}
+
+		var stacks []string
+		var otherTagRules []ac.TagRule
+		for _, tagRule := range tagRules {
+			if tagRule.Name == CloudFormationStackIDTag && isCloudFormationStackARN(tagRule.Value) {
+				stacks = append(stacks, tagRule.Value)
+			} else {
+				otherTagRules = append(otherTagRules, tagRule)
+			}
+		}
+
+		tags, tagRuleBlocks := groupTagRules(otherTagRules)
+		blocks = append(blocks, newResourcesBlock(arns, stacks, tags, tagRuleBlocks))
+
+		for _, arns := range arnRules {
+			blocks = append(blocks, newResourcesBlock(arns, nil, nil, nil))
+		}
+	}
+
+	return d.Set("resources", blocks)
+}
+
+// groupTagRules groups tag rules by key.  Keys with a single value go in the
+// tags map; keys with several values get a tag_rule block.
+func groupTagRules(rules []ac.TagRule) (tags map[string]string, tagRuleBlocks []interface{}) {
+	keys := []string{}
+	values := map[string][]string{}
+	anyValue := map[string]bool{}
+	for _, rule := range rules {
+		if _, ok := values[rule.Name]; !ok {
+			keys = append(keys, rule.Name)
+			values[rule.Name] = []string{}
+		}
+		if rule.Value == "" {
+			anyValue[rule.Name] = true
+		} else {
+			values[rule.Name] = append(values[rule.Name], rule.Value)
+		}
+	}
+	sort.Strings(keys)
+
+	tags = map[string]string{}
+	for _, k := range keys {
+		if anyValue[k] {
+			tags[k] = ""
+		} else if len(values[k]) == 1 {
+			tags[k] = values[k][0]
+			continue
+		}
+		if len(values[k]) > 0 {
+			tagRuleBlocks = append(tagRuleBlocks, newTagRuleBlock(k, values[k], false))
+		}
+	}
+
+	return tags, tagRuleBlocks
+}
+
+func isCloudFormationStackARN(a string) bool {
+	arn, err := ParseARN(a)
+	return err == nil && arn.IsCloudFormationStack()
+}
+
+func newResourcesBlock(arns, stacks []string, tags map[string]string, tagRuleBlocks []interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"arns":                  schema.NewSet(schema.HashString, UntypifyStringList(arns)),
+		"cloudformation_stacks": schema.NewSet(schema.HashString, UntypifyStringList(stacks)),
+		"tags":                  UntypifyStringMap(tags),
+		"tag_rule":              tagRuleBlocks,
+	}
+}
+
+func newTagRuleBlock(key string, values []string, exists bool) map[string]interface{} {
+	return map[string]interface{}{
+		"key":    key,
+		"values": schema.NewSet(schema.HashString, UntypifyStringList(values)),
+		"exists": exists,
+	}
+}
@@ -0,0 +1,161 @@
+package arpio
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	ac "github.com/arpio/arpio-client-go"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestAppSelectionRulesRoundTrip(t *testing.T) {
+	raw := map[string]interface{}{
+		"primary_account_id": "123456789012",
+		"primary_region":     "us-east-1",
+		"resources": []interface{}{
+			map[string]interface{}{
+				"arns": []interface{}{"arn:aws:ec2:us-east-1:123456789012:instance/i-b", "arn:aws:ec2:us-east-1:123456789012:instance/i-a"},
+				"tags": map[string]interface{}{"Team": "a"},
+			},
+			map[string]interface{}{
+				"cloudformation_stacks": []interface{}{"arn:aws:cloudformation:us-east-1:123456789012:stack/site/0f3e2a50-1c1e-11ec-9621-0242ac130002"},
+			},
+			map[string]interface{}{
+				"tags": map[string]interface{}{"Team": "b", "Service": "c"},
+				"tag_rule": []interface{}{
+					map[string]interface{}{"key": "Tier", "values": []interface{}{"db", "cache"}},
+					map[string]interface{}{"key": "Backup", "exists": true},
+				},
+			},
+		},
+	}
+	d := schema.TestResourceDataRaw(t, resourceArpioApp().Schema, raw)
+
+	var app ac.App
+	if err := setAppSelectionRulesFromResourceData(d, &app); err != nil {
+		t.Fatal(err)
+	}
+	if len(app.SelectionRules) != 8 {
+		t.Fatalf("expected 8 rules, got %d", len(app.SelectionRules))
+	}
+
+	// Reading the rules back keeps the blocks they came from
+	before := d.Get("resources").(*schema.Set)
+	if err := setResourceDataSelectionRulesFromApp(d, app); err != nil {
+		t.Fatal(err)
+	}
+	if after := d.Get("resources").(*schema.Set); !before.Equal(after) {
+		t.Fatalf("%v != %v", before.List(), after.List())
+	}
+
+	// Without state, the rules are grouped into as few blocks as possible
+	empty := schema.TestResourceDataRaw(t, resourceArpioApp().Schema, map[string]interface{}{})
+	if err := setResourceDataSelectionRulesFromApp(empty, app); err != nil {
+		t.Fatal(err)
+	}
+	blocks := empty.Get("resources").(*schema.Set).List()
+	if len(blocks) != 1 {
+		t.Fatalf("expected 1 block, got %d", len(blocks))
+	}
+	block := blocks[0].(map[string]interface{})
+	if n := len(block["tags"].(map[string]interface{})); n != 2 {
+		t.Fatalf("expected 2 tags (Service, Backup), got %d", n)
+	}
+	if n := block["tag_rule"].(*schema.Set).Len(); n != 2 {
+		t.Fatalf("expected 2 tag rules (Team, Tier), got %d", n)
+	}
+	if n := block["cloudformation_stacks"].(*schema.Set).Len(); n != 1 {
+		t.Fatalf("expected 1 CloudFormation stack, got %d", n)
+	}
+}
+
+func TestAppSelectionRulesOutsidePrimary(t *testing.T) {
+	arns := []string{
+		"arn:aws:ec2:us-west-2:123456789012:instance/i-a",
+		"arn:aws:ec2:us-east-1:210987654321:instance/i-a",
+	}
+	for _, arn := range arns {
+		raw := map[string]interface{}{
+			"primary_account_id": "123456789012",
+			"primary_region":     "us-east-1",
+			"resources": []interface{}{
+				map[string]interface{}{
+					"arns": []interface{}{arn},
+				},
+			},
+		}
+		d := schema.TestResourceDataRaw(t, resourceArpioApp().Schema, raw)
+
+		var app ac.App
+		if err := setAppSelectionRulesFromResourceData(d, &app); err == nil {
+			t.Fatalf("%s should not be accepted outside the primary account and region", arn)
+		}
+	}
+}
+
+func TestResourceArpioAppResourcesPlanErrors(t *testing.T) {
+	tests := map[string][]interface{}{
+		"must specify at least one ARN": {
+			map[string]interface{}{},
+		},
+		"appears in more than one tags or tag_rule entry": {
+			map[string]interface{}{"tags": map[string]interface{}{"Team": "a"}},
+			map[string]interface{}{
+				"arns":     []interface{}{"arn:aws:ec2:us-east-1:123456789012:instance/i-a"},
+				"tag_rule": []interface{}{map[string]interface{}{"key": "Team", "values": []interface{}{"a", "b"}}},
+			},
+		},
+	}
+	for want, blocks := range tests {
+		config := terraform.NewResourceConfigRaw(map[string]interface{}{
+			"name":                "site",
+			"rpo":                 "60",
+			"primary_account_id":  "123456789012",
+			"primary_region":      "us-east-1",
+			"recovery_account_id": "210987654321",
+			"recovery_region":     "us-west-2",
+			"resources":           blocks,
+		})
+		_, err := resourceArpioApp().Diff(context.Background(), nil, config, nil)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected a plan error containing %q, got %v", want, err)
+		}
+	}
+}
+
+func TestExpandTagRule(t *testing.T) {
+	cases := []struct {
+		attrs  map[string]interface{}
+		values []string
+		err    bool
+	}{
+		{
+			attrs:  map[string]interface{}{"key": "k", "values": schema.NewSet(schema.HashString, []interface{}{"b", "a"}), "exists": false},
+			values: []string{"a", "b"},
+		},
+		{
+			attrs:  map[string]interface{}{"key": "k", "values": schema.NewSet(schema.HashString, nil), "exists": true},
+			values: []string{""},
+		},
+		{
+			attrs: map[string]interface{}{"key": "k", "values": schema.NewSet(schema.HashString, []interface{}{"a"}), "exists": true},
+			err:   true,
+		},
+		{
+			attrs: map[string]interface{}{"key": "k", "values": schema.NewSet(schema.HashString, nil), "exists": false},
+			err:   true,
+		},
+	}
+
+	for i, c := range cases {
+		_, values, err := expandTagRule(c.attrs)
+		if (err != nil) != c.err {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		if !StringListsEqual(values, c.values) {
+			t.Fatalf("case %d: %v != %v", i, values, c.values)
+		}
+	}
+}
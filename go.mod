@@ -5,6 +5,7 @@ go 1.13
 require (
 	github.com/arpio/arpio-client-go v0.1.3
 	github.com/arpio/patchenv v1.0.0
+	github.com/hashicorp/go-cty v1.4.1-0.20200414143053-d3edf31b6320
 	github.com/hashicorp/terraform-plugin-sdk/v2 v2.7.0
 )
 